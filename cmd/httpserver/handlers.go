@@ -2,79 +2,65 @@ package main
 
 import (
 	"crypto/sha256"
-	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
-	"os"
+	"net/url"
 	"strconv"
-	"strings"
 
-	"github.com/sambakker4/httpfromtcp/internal/headers"
 	"github.com/sambakker4/httpfromtcp/internal/request"
 	"github.com/sambakker4/httpfromtcp/internal/response"
 )
 
 func handlerHTTPBin(w *response.Writer, req *request.Request) {
-	endpoint := strings.TrimPrefix(req.RequestLine.RequestTarget, "/httpbin/")
-
-	resp, err := http.Get("https://httpbin.org/" + endpoint)
-	if err != nil {
-		log.Printf("error: %v\n", err)
+	upstream := url.URL{
+		Scheme:   "https",
+		Host:     "httpbin.org",
+		Path:     "/" + req.PathValue("path"),
+		RawQuery: req.RequestLine.Target.RawQuery,
 	}
 
-	err = w.WriteStatusLine(200)
+	resp, err := http.Get(upstream.String())
 	if err != nil {
 		log.Printf("error: %v\n", err)
+		w.SetStatus(response.BadGateway)
+		return
 	}
+	defer resp.Body.Close()
 
-	hdrs := response.GetDefaultHeaders(0)
-	hdrs.Set("Transfer-Encoding", "chunked")
-	hdrs.Set("Trailer", "X-Content-SHA256, X-Content-Length")
-	delete(hdrs, "content-length")
-
-	err = w.WriteHeaders(hdrs)
-
+	w.Headers().Set("Content-Type", "text/plain")
+	err = w.DeclareTrailer("X-Content-SHA256", "X-Content-Length")
 	if err != nil {
 		log.Printf("error: %v\n", err)
-	}
-	fullResponse := ""
-
-	buf := make([]byte, 1024)
-	n := -1
-	for n != 0 {
-		n, err = resp.Body.Read(buf)
-		if err != nil {
-			if errors.Is(err, io.EOF) {
-				break
-			}
-			log.Printf("error: %v\n", err)
-		}
-		fullResponse += string(buf[:n])
-
-		n, err = w.WriteChunkedBody(buf[:n])
-		if err != nil {
-			log.Printf("error: %v\n", err)
-		}
+		w.SetStatus(response.InternalServerError)
+		return
 	}
 
-	_, err = w.WriteChunkedBodyDone()
+	hash := sha256.New()
+	length, err := io.Copy(io.MultiWriter(w, hash), resp.Body)
 	if err != nil {
 		log.Printf("error: %v\n", err)
+		return
 	}
 
-	hash := sha256.Sum256([]byte(fullResponse))
-	length := len(fullResponse)
-
-	headers := headers.NewHeaders()
-	headers.Set("X-Content-SHA256", fmt.Sprintf("%x", hash))
-	headers.Set("X-Content-Length", strconv.Itoa(length))
+	w.SetTrailer("X-Content-SHA256", fmt.Sprintf("%x", hash.Sum(nil)))
+	w.SetTrailer("X-Content-Length", strconv.FormatInt(length, 10))
+}
 
-	err = w.WriteTrailers(headers)
-	if err != nil {
-		log.Printf("error: %v\n", err)
-	}
+func handlerSuccess(w *response.Writer, req *request.Request) {
+	html := `<html>
+  <head>
+    <title>200 OK</title>
+  </head>
+  <body>
+    <h1>Success!</h1>
+    <p>Your request was an absolute banger.</p>
+  </body>
+</html>
+`
+	w.Headers().Set("Content-Type", "text/html")
+	w.Write([]byte(html))
 }
 
 func handlerYourProblem(w *response.Writer, req *request.Request) {
@@ -88,11 +74,9 @@ func handlerYourProblem(w *response.Writer, req *request.Request) {
   </body>
 </html>
 `
-	headers := response.GetDefaultHeaders(len([]byte(html)))
-	headers.Set("Content-type", "text/html")
-	w.WriteStatusLine(400)
-	w.WriteHeaders(headers)
-	w.WriteBody([]byte(html))
+	w.SetStatus(response.BadRequest)
+	w.Headers().Set("Content-Type", "text/html")
+	w.Write([]byte(html))
 }
 
 func handlerMyProblem(w *response.Writer, req *request.Request) {
@@ -106,22 +90,11 @@ func handlerMyProblem(w *response.Writer, req *request.Request) {
   </body>
 </html>
 `
-	headers := response.GetDefaultHeaders(len([]byte(html)))
-	headers.Set("Content-type", "text/html")
-	w.WriteStatusLine(500)
-	w.WriteHeaders(headers)
-	w.WriteBody([]byte(html))
+	w.SetStatus(response.InternalServerError)
+	w.Headers().Set("Content-Type", "text/html")
+	w.Write([]byte(html))
 }
 
 func handlerGetVideo(w *response.Writer, req *request.Request) {
-	data, err := os.ReadFile("/home/sambakker/workspace/github.com/sambakker4/httpfromtcp/assets/vim.mp4")
-	if err != nil {
-		log.Printf("error: %s\n", err.Error())
-	}
-	headers := response.GetDefaultHeaders(len(data))
-	headers.Set("Content-Type", "video/mp4")
-
-	w.WriteStatusLine(200)
-	w.WriteHeaders(headers)
-	w.WriteBody(data)
+	response.ServeFile(w, req, videoPath)
 }
@@ -1,64 +1,63 @@
 package main
 
 import (
+	"compress/flate"
+	"context"
 	"log"
 	"os"
 	"os/signal"
-	"strings"
 	"syscall"
+	"time"
 
-	"github.com/sambakker4/httpfromtcp/internal/request"
-	"github.com/sambakker4/httpfromtcp/internal/response"
 	"github.com/sambakker4/httpfromtcp/internal/server"
 )
 
-const port = 42069
+const (
+	port            = 42069
+	shutdownTimeout = 10 * time.Second
+
+	readHeaderTimeout = 10 * time.Second
+	idleTimeout       = 60 * time.Second
+
+	compressMinSize = 1024
+
+	assetsDir = "assets"
+	videoPath = "assets/vim.mp4"
+)
 
 func main() {
-	server, err := server.Serve(port, handler)
+	assets := server.NewFileServer("/assets", server.Dir(assetsDir))
+	assets.Listing = true
+
+	router := server.NewRouter()
+	router.Use(server.LogRequests(log.Default()), server.Compress(flate.DefaultCompression, compressMinSize))
+	router.Handle("/", handlerSuccess)
+	router.Handle("/httpbin/*path", handlerHTTPBin)
+	router.Handle("GET /video", handlerGetVideo)
+	router.Handle("GET /assets/*path", assets.ServeHTTP)
+	router.Handle("/yourproblem", handlerYourProblem)
+	router.Handle("/myproblem", handlerMyProblem)
+
+	server, err := server.Serve(port, router.ServeHTTP,
+		server.WithReadHeaderTimeout(readHeaderTimeout),
+		server.WithIdleTimeout(idleTimeout),
+	)
 	if err != nil {
 		log.Fatalf("Error starting server: %v", err)
 	}
-	defer server.Close()
 	log.Println("Server started on port", port)
 
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 	<-sigChan
-	log.Println("Server gracefully stopped")
-}
 
-func handler(w *response.Writer, req *request.Request) {
-	if strings.HasPrefix(req.RequestLine.RequestTarget, "/httpbin/") {
-		handlerHTTPBin(w, req)
-		return
-	}
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
 
-	if req.RequestLine.RequestTarget == "/video" && req.RequestLine.Method == "GET" {
-		handlerGetVideo(w, req)
+	cutOff, err := server.Shutdown(ctx)
+	if err != nil {
+		log.Printf("Server stopped, %d connections cut off: %v", cutOff, err)
 		return
 	}
-
-	switch req.RequestLine.RequestTarget {
-	case "/yourproblem":
-		handlerYourProblem(w, req)
-	case "/myproblem":
-		handlerMyProblem(w, req)
-	default:
-		html := `<html>
-  <head>
-    <title>200 OK</title>
-  </head>
-  <body>
-    <h1>Success!</h1>
-    <p>Your request was an absolute banger.</p>
-  </body>
-</html>
-`
-		headers := response.GetDefaultHeaders(len([]byte(html)))
-		headers.Set("Content-type", "text/html")
-		w.WriteStatusLine(200)
-		w.WriteHeaders(headers)
-		w.WriteBody([]byte(html))
-	}
+	log.Println("Server gracefully stopped")
 }
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"github.com/sambakker4/httpfromtcp/internal/request"
+	"io"
 	"log"
 	"net"
 )
@@ -25,6 +26,7 @@ func main() {
 		req, err := request.RequestFromReader(connection)
 		if err != nil {
 			log.Printf("error: %s", err.Error())
+			continue
 		}
 
 		fmt.Println("Request Line:")
@@ -33,12 +35,17 @@ func main() {
 		fmt.Println(" - Version:", req.RequestLine.HttpVersion)
 
 		fmt.Println("Headers:")
-		for key, value := range req.Headers {
+		for key, value := range req.Headers.All() {
 			fmt.Printf(" - %s: %s\n", key, value)
 		}
 
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			log.Printf("error: %s", err.Error())
+		}
+
 		fmt.Println("Body:")
-		fmt.Println(string(req.Body))
+		fmt.Println(string(body))
 		fmt.Println()
 	}
 }
@@ -2,13 +2,26 @@ package headers
 
 import (
 	"errors"
-	"regexp"
+	"fmt"
+	"iter"
+	"slices"
 	"strings"
 )
 
-type Headers map[string]string
+// Headers is a list of header fields. Every field line is kept
+// separately, so a name can have several values, and fields keep the order
+// they were added in and the case of their names and values. Names are
+// matched case insensitively.
+type Headers struct {
+	fields []field
+}
+
+type field struct {
+	name  string
+	value string
+}
 
-func (h Headers) Parse(data []byte) (n int, done bool, err error) {
+func (h *Headers) Parse(data []byte) (n int, done bool, err error) {
 	if !strings.Contains(string(data), "\r\n") {
 		return 0, false, nil
 	}
@@ -26,41 +39,163 @@ func (h Headers) Parse(data []byte) (n int, done bool, err error) {
 	}
 
 	key, value := header[0], header[1]
-	if key[len(key)-1] == ' ' {
+	if key == "" || key[len(key)-1] == ' ' {
 		return 0, false, errors.New("error: header format must be <key>: <value>")
 	}
 
-	re := regexp.MustCompile(`^[A-Za-z0-9!#$%&'*+\-.\^_` + "`" + `|~]+$`)
-	if !re.MatchString(key) || len(key) == 0 {
+	if !ValidName(key) {
 		return 0, false, errors.New("error: key contains invalid characters")
 	}
 
+	if !ValidValue(value) {
+		return 0, false, errors.New("error: value contains invalid characters")
+	}
+
 	n = len(line[0]) + len("\r\n")
 	err = nil
 	done = false
 	value = strings.TrimSpace(value)
 
-	if h.Get(key) != "" {
-		h[strings.ToLower(key)] = h.Get(key) + ", " + value
+	h.Add(key, value)
+	return
+}
+
+func NewHeaders() *Headers {
+	return &Headers{}
+}
+
+func (h *Headers) index(key string) int {
+	for i, f := range h.fields {
+		if strings.EqualFold(f.name, key) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Get returns the first value of key, or "" if key isn't present. Use
+// Values for fields that can appear more than once.
+func (h *Headers) Get(key string) string {
+	i := h.index(key)
+	if i == -1 {
+		return ""
+	}
+	return h.fields[i].value
+}
+
+// Values returns every value of key in order.
+func (h *Headers) Values(key string) []string {
+	var values []string
+	for _, f := range h.fields {
+		if strings.EqualFold(f.name, key) {
+			values = append(values, f.value)
+		}
+	}
+	return values
+}
+
+// Add adds a field at the end, after any existing values of key.
+func (h *Headers) Add(key string, val string) {
+	h.fields = append(h.fields, field{name: key, value: val})
+}
+
+// Set replaces all values of key with val. The field keeps the position of
+// the first existing value, or is added at the end if key isn't present.
+func (h *Headers) Set(key string, val string) {
+	i := h.index(key)
+	if i == -1 {
+		h.Add(key, val)
 		return
 	}
 
-	h[strings.ToLower(key)] = value
-	return
+	h.fields[i].value = val
+	rest := slices.DeleteFunc(h.fields[i+1:], func(f field) bool {
+		return strings.EqualFold(f.name, key)
+	})
+	h.fields = h.fields[:i+1+len(rest)]
 }
 
-func NewHeaders() Headers {
-	return Headers{}
+// Del removes every value of key.
+func (h *Headers) Del(key string) {
+	h.fields = slices.DeleteFunc(h.fields, func(f field) bool {
+		return strings.EqualFold(f.name, key)
+	})
 }
 
-func (h Headers) Get(s string) string {
-	val, ok := h[strings.ToLower(s)]
-	if !ok {
-		return ""
+func (h *Headers) Clone() *Headers {
+	return &Headers{fields: slices.Clone(h.fields)}
+}
+
+func (h *Headers) Len() int {
+	return len(h.fields)
+}
+
+// All iterates over the fields in the order they were added, with names in
+// the case they were added with.
+func (h *Headers) All() iter.Seq2[string, string] {
+	return func(yield func(string, string) bool) {
+		for _, f := range h.fields {
+			if !yield(f.name, f.value) {
+				return
+			}
+		}
 	}
-	return val
 }
 
-func (h Headers) Set(key string, val string) {
-	h[strings.ToLower(key)] = strings.ToLower(val)
+// HasToken reports whether the comma-separated lists in the values of key
+// contain token, ignoring case.
+func (h *Headers) HasToken(key string, token string) bool {
+	for _, val := range h.Values(key) {
+		for _, item := range strings.Split(val, ",") {
+			if strings.EqualFold(strings.TrimSpace(item), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ValidName reports whether name is a valid field name: a non-empty token.
+func ValidName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case strings.IndexByte("!#$%&'*+-.^_`|~", c) != -1:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// ValidValue reports whether value is a valid field value. Visible
+// characters, spaces, tabs and obs-text are allowed; CR, LF, NUL and the
+// other control characters are not, so a value can't end the field line
+// early and inject another field.
+func ValidValue(value string) bool {
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if (c < ' ' && c != '\t') || c == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// Validate checks every field name and value, so invalid input is caught
+// before any of it is written.
+func (h *Headers) Validate() error {
+	for _, f := range h.fields {
+		if !ValidName(f.name) {
+			return fmt.Errorf("error: invalid header name %q", f.name)
+		}
+		if !ValidValue(f.value) {
+			return fmt.Errorf("error: invalid value for header %q", f.name)
+		}
+	}
+	return nil
 }
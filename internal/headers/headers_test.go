@@ -103,5 +103,99 @@ func TestParseHeaders(t *testing.T) {
 	n += num
 	require.NoError(t, err)
 	assert.False(t, done)
-	assert.Equal(t, "bob, fred, joe", headers.Get("Set-Person"))
+	assert.Equal(t, []string{"bob", "fred", "joe"}, headers.Values("Set-Person"))
+	assert.Equal(t, "bob", headers.Get("Set-Person"))
+}
+
+func TestHeadersOrder(t *testing.T) {
+	// Test: Fields keep their order and the case of their names
+	headers := NewHeaders()
+	data := []byte("Host: localhost\r\nx-custom-header: one\r\nAccept: */*\r\nX-CUSTOM-HEADER: two\r\n\r\n")
+	for {
+		n, done, err := headers.Parse(data)
+		require.NoError(t, err)
+		data = data[n:]
+		if done {
+			break
+		}
+	}
+
+	var names []string
+	for name := range headers.All() {
+		names = append(names, name)
+	}
+	assert.Equal(t, []string{"Host", "x-custom-header", "Accept", "X-CUSTOM-HEADER"}, names)
+	assert.Equal(t, []string{"one", "two"}, headers.Values("X-Custom-Header"))
+
+	// Test: Set keeps the position of an existing field
+	headers.Set("HOST", "example.com")
+	headers.Set("Content-Type", "text/plain")
+	names = nil
+	for name, value := range headers.All() {
+		names = append(names, name+"="+value)
+	}
+	assert.Equal(t, []string{"Host=example.com", "x-custom-header=one", "Accept=*/*", "X-CUSTOM-HEADER=two", "Content-Type=text/plain"}, names)
+
+	// Test: Del
+	headers.Del("x-CUSTOM-header")
+	assert.Equal(t, "", headers.Get("X-Custom-Header"))
+	assert.Equal(t, 3, headers.Len())
+}
+
+func TestHeadersMultipleValues(t *testing.T) {
+	// Test: Add keeps every value with its case
+	headers := NewHeaders()
+	headers.Add("Set-Cookie", "a=1; Path=/")
+	headers.Add("Content-Type", "text/plain")
+	headers.Add("set-cookie", "B=2; Expires=Wed, 21 Oct 2026 07:28:00 GMT")
+	assert.Equal(t, []string{"a=1; Path=/", "B=2; Expires=Wed, 21 Oct 2026 07:28:00 GMT"}, headers.Values("SET-COOKIE"))
+	assert.Equal(t, "a=1; Path=/", headers.Get("Set-Cookie"))
+	assert.Nil(t, headers.Values("Missing"))
+
+	// Test: Clone is independent of the original
+	clone := headers.Clone()
+	clone.Add("Set-Cookie", "c=3")
+	assert.Len(t, headers.Values("Set-Cookie"), 2)
+	assert.Len(t, clone.Values("Set-Cookie"), 3)
+
+	// Test: Set replaces every value at the position of the first
+	clone.Set("Set-Cookie", "d=4")
+	var fields []string
+	for name, value := range clone.All() {
+		fields = append(fields, name+"="+value)
+	}
+	assert.Equal(t, []string{"Set-Cookie=d=4", "Content-Type=text/plain"}, fields)
+
+	// Test: Del removes every value
+	headers.Del("set-cookie")
+	assert.Nil(t, headers.Values("Set-Cookie"))
+	assert.Equal(t, 1, headers.Len())
+}
+
+func TestHeaderValidation(t *testing.T) {
+	// Test: Control characters in a parsed value
+	for _, line := range []string{"X-Test: a\x00b\r\n", "X-Test: a\rb\r\n", "X-Test: a\nb\r\n", "X-Test: a\x7fb\r\n", ": value\r\n"} {
+		headers := NewHeaders()
+		n, done, err := headers.Parse([]byte(line))
+		require.Error(t, err, "%q", line)
+		assert.Equal(t, 0, n)
+		assert.False(t, done)
+	}
+
+	// Test: Tabs and obs-text are allowed
+	headers := NewHeaders()
+	_, _, err := headers.Parse([]byte("X-Test: a\tb\xe9\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "a\tb\xe9", headers.Get("X-Test"))
+
+	// Test: Validate catches values and names that were set
+	headers = NewHeaders()
+	headers.Set("Location", "/ok")
+	require.NoError(t, headers.Validate())
+	headers.Set("Location", "/\r\nSet-Cookie: evil=1")
+	require.Error(t, headers.Validate())
+
+	headers = NewHeaders()
+	headers.Set("Bad Name", "value")
+	require.Error(t, headers.Validate())
 }
@@ -0,0 +1,251 @@
+package request
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/sambakker4/httpfromtcp/internal/headers"
+)
+
+const maxChunkSizeDigits = 15
+
+// parseChunkSize parses a chunk-size line, including any chunk extensions,
+// and returns the size of the chunk that follows. It returns 0 bytes parsed
+// when the line is not complete yet.
+func parseChunkSize(data []byte) (size int64, n int, err error) {
+	idx := bytes.Index(data, []byte("\r\n"))
+	if idx == -1 {
+		return 0, 0, nil
+	}
+
+	line := string(data[:idx])
+	if strings.ContainsAny(line, "\r\n") {
+		return 0, 0, fmt.Errorf("%w: invalid chunk size line", ErrBadChunkedEncoding)
+	}
+
+	sizeStr, extensions, _ := strings.Cut(line, ";")
+	sizeStr = strings.TrimRight(sizeStr, " \t")
+	if sizeStr == "" || len(sizeStr) > maxChunkSizeDigits {
+		return 0, 0, fmt.Errorf("%w: invalid chunk size", ErrBadChunkedEncoding)
+	}
+
+	parsed, err := strconv.ParseUint(sizeStr, 16, 62)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: invalid chunk size", ErrBadChunkedEncoding)
+	}
+
+	if err := validateChunkExtensions(extensions); err != nil {
+		return 0, 0, err
+	}
+
+	return int64(parsed), idx + len("\r\n"), nil
+}
+
+// validateChunkExtensions checks the part of a chunk-size line after the
+// first ";". Extensions are accepted and ignored, but must be well formed.
+func validateChunkExtensions(extensions string) error {
+	if extensions == "" {
+		return nil
+	}
+
+	for _, ext := range strings.Split(extensions, ";") {
+		name, value, hasValue := strings.Cut(ext, "=")
+		name = strings.Trim(name, " \t")
+		if !isToken(name) {
+			return fmt.Errorf("%w: invalid chunk extension", ErrBadChunkedEncoding)
+		}
+
+		if !hasValue {
+			continue
+		}
+
+		value = strings.Trim(value, " \t")
+		if isToken(value) {
+			continue
+		}
+		if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+			continue
+		}
+		return fmt.Errorf("%w: invalid chunk extension", ErrBadChunkedEncoding)
+	}
+	return nil
+}
+
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case strings.IndexByte("!#$%&'*+-.^_`|~", c) != -1:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// isChunked reports whether the request body uses the chunked transfer
+// coding. Any other transfer coding is an error.
+func (r *Request) isChunked() (bool, error) {
+	transferEncoding := strings.Join(r.Headers.Values("Transfer-Encoding"), ",")
+	if transferEncoding == "" {
+		return false, nil
+	}
+
+	if r.Headers.Values("Content-Length") != nil {
+		return false, fmt.Errorf("%w: both Transfer-Encoding and Content-Length are set", ErrBadContentLength)
+	}
+
+	if !strings.EqualFold(strings.TrimSpace(transferEncoding), "chunked") {
+		return false, ErrUnsupportedTransferEncoding
+	}
+	return true, nil
+}
+
+const (
+	chunkedStateSize = iota
+	chunkedStateData
+	chunkedStateDataEnd
+	chunkedStateTrailers
+	chunkedStateDone
+)
+
+// chunkedReader decodes a chunked body as it is read. Trailers are added
+// to trailers once the last chunk has been read.
+type chunkedReader struct {
+	src       *Reader
+	req       *Request
+	trailers  *headers.Headers
+	state     int
+	read      int64
+	remaining int64
+	err       error
+
+	trailerBytes int
+	trailerCount int
+}
+
+func (r *chunkedReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	n, err := r.decode(p)
+	if err != nil {
+		r.err = err
+	}
+	return n, err
+}
+
+func (r *chunkedReader) decode(p []byte) (int, error) {
+	for {
+		switch r.state {
+		case chunkedStateSize:
+			err := r.src.parseNext(maxChunkSizeLineBytes, ErrBadChunkedEncoding, func(data []byte) (int, error) {
+				size, n, err := parseChunkSize(data)
+				r.remaining = size
+				return n, err
+			})
+			if err != nil {
+				return 0, err
+			}
+
+			if r.req.bodyTooLarge(r.read + r.remaining) {
+				return 0, ErrBodyTooLarge
+			}
+
+			if r.remaining == 0 {
+				r.state = chunkedStateTrailers
+			} else {
+				r.state = chunkedStateData
+			}
+
+		case chunkedStateData:
+			if len(p) == 0 {
+				return 0, nil
+			}
+
+			if int64(len(p)) > r.remaining {
+				p = p[:r.remaining]
+			}
+
+			n, err := r.src.Read(p)
+			r.read += int64(n)
+			r.remaining -= int64(n)
+			if r.remaining == 0 {
+				r.state = chunkedStateDataEnd
+			}
+
+			if errors.Is(err, io.EOF) {
+				if r.remaining > 0 {
+					return n, io.ErrUnexpectedEOF
+				}
+				err = nil
+			}
+			return n, err
+
+		case chunkedStateDataEnd:
+			err := r.src.parseNext(0, nil, func(data []byte) (int, error) {
+				if len(data) < len("\r\n") {
+					return 0, nil
+				}
+
+				if string(data[:2]) != "\r\n" {
+					return 0, fmt.Errorf("%w: chunk data not followed by CRLF", ErrBadChunkedEncoding)
+				}
+				return len("\r\n"), nil
+			})
+			if err != nil {
+				return 0, err
+			}
+			r.state = chunkedStateSize
+
+		case chunkedStateTrailers:
+			// The trailer section shares the header limits, counted across
+			// the whole section rather than per line.
+			limits := r.req.limits
+			done := false
+			for !done {
+				pending := 0
+				if limits.MaxHeaderBytes > 0 {
+					pending = max(limits.MaxHeaderBytes-r.trailerBytes, 1)
+				}
+
+				err := r.src.parseNext(pending, ErrHeadersTooLarge, func(data []byte) (int, error) {
+					n, d, err := r.trailers.Parse(data)
+					if err != nil {
+						return 0, fmt.Errorf("%w: %w", ErrBadChunkedEncoding, err)
+					}
+
+					r.trailerBytes += n
+					if limits.MaxHeaderBytes > 0 && r.trailerBytes > limits.MaxHeaderBytes {
+						return 0, ErrHeadersTooLarge
+					}
+
+					if n > 0 && !d {
+						r.trailerCount++
+						if limits.MaxHeaderCount > 0 && r.trailerCount > limits.MaxHeaderCount {
+							return 0, fmt.Errorf("%w: too many trailers", ErrHeadersTooLarge)
+						}
+					}
+					done = d
+					return n, nil
+				})
+				if err != nil {
+					return 0, err
+				}
+			}
+			r.state = chunkedStateDone
+
+		case chunkedStateDone:
+			return 0, io.EOF
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package request
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DecompressBody makes Body decode the content codings listed in the
+// request's Content-Encoding, so handlers read the uncompressed body. gzip,
+// x-gzip, deflate and identity are supported; any other coding returns
+// ErrUnsupportedContentEncoding and leaves the request untouched.
+//
+// maxBytes bounds the size of the decompressed body, or 0 for no limit.
+// Reading past it makes Body return ErrBodyTooLarge, which guards against
+// small bodies that decompress to huge ones. A body that isn't valid for
+// its coding makes Body return ErrBadContentEncoding.
+//
+// The Content-Encoding and Content-Length headers are removed, since they
+// no longer describe Body.
+func (r *Request) DecompressBody(maxBytes int64) error {
+	if r.Headers.Values("Content-Encoding") == nil {
+		return nil
+	}
+
+	var codings []string
+	for _, value := range r.Headers.Values("Content-Encoding") {
+		for _, coding := range strings.Split(value, ",") {
+			coding = strings.ToLower(strings.TrimSpace(coding))
+			switch coding {
+			case "", "identity":
+			case "gzip", "x-gzip", "deflate":
+				codings = append(codings, coding)
+			default:
+				return fmt.Errorf("%w: %s", ErrUnsupportedContentEncoding, coding)
+			}
+		}
+	}
+
+	r.Headers.Del("Content-Encoding")
+	if len(codings) == 0 {
+		return nil
+	}
+	r.Headers.Del("Content-Length")
+
+	// Codings are listed in the order they were applied, so the last one
+	// is undone first.
+	body := r.Body
+	for i := len(codings) - 1; i >= 0; i-- {
+		body = &decodingReader{src: body, coding: codings[i]}
+	}
+	r.Body = &decompressedReader{src: body, max: maxBytes}
+	return nil
+}
+
+// decodingReader undoes one content coding. The decompressor is created on
+// the first read, since creating it reads the start of the body.
+type decodingReader struct {
+	src     io.Reader
+	coding  string
+	decoder io.Reader
+	err     error
+}
+
+func (d *decodingReader) Read(p []byte) (int, error) {
+	if d.err != nil {
+		return 0, d.err
+	}
+
+	if d.decoder == nil {
+		// flate reads a byte at a time from anything that isn't an
+		// io.ByteReader.
+		src := bufio.NewReader(d.src)
+		var err error
+		if d.coding == "deflate" {
+			d.decoder, err = zlib.NewReader(src)
+		} else {
+			d.decoder, err = gzip.NewReader(src)
+		}
+		if err != nil {
+			d.err = decodingError(err)
+			return 0, d.err
+		}
+	}
+
+	n, err := d.decoder.Read(p)
+	if err != nil && !errors.Is(err, io.EOF) {
+		d.err = decodingError(err)
+		err = d.err
+	}
+	return n, err
+}
+
+// decodingError turns an error from a decompressor into a ParseError.
+// Errors reading the body itself are already ParseErrors.
+func decodingError(err error) error {
+	var parseErr *ParseError
+	if errors.As(err, &parseErr) {
+		return err
+	}
+
+	var corrupt flate.CorruptInputError
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, gzip.ErrHeader) ||
+		errors.Is(err, gzip.ErrChecksum) || errors.Is(err, zlib.ErrHeader) || errors.Is(err, zlib.ErrChecksum) ||
+		errors.Is(err, zlib.ErrDictionary) || errors.As(err, &corrupt) {
+		return fmt.Errorf("%w: %w", ErrBadContentEncoding, err)
+	}
+	return err
+}
+
+// decompressedReader fails with ErrBodyTooLarge once the decompressed
+// body grows past max bytes, if max isn't 0.
+type decompressedReader struct {
+	src  io.Reader
+	max  int64
+	read int64
+	err  error
+}
+
+func (d *decompressedReader) Read(p []byte) (int, error) {
+	if d.err != nil {
+		return 0, d.err
+	}
+
+	if d.max > 0 && d.read >= d.max {
+		// Only fail if there is more to read than the limit allows.
+		var b [1]byte
+		n, err := d.src.Read(b[:])
+		if n > 0 {
+			d.err = fmt.Errorf("%w: decompressed body is larger than %d bytes", ErrBodyTooLarge, d.max)
+			return 0, d.err
+		}
+		return 0, err
+	}
+
+	if d.max > 0 && int64(len(p)) > d.max-d.read {
+		p = p[:d.max-d.read]
+	}
+
+	n, err := d.src.Read(p)
+	d.read += int64(n)
+	return n, err
+}
@@ -0,0 +1,110 @@
+package request
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func gzipped(t *testing.T, data string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err := gz.Write([]byte(data))
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+	return buf.String()
+}
+
+func compressedRequest(t *testing.T, contentEncoding string, body string) *Request {
+	t.Helper()
+	r, err := RequestFromReader(&chunkReader{
+		data: "POST /upload HTTP/1.1\r\nHost: localhost\r\nContent-Encoding: " + contentEncoding +
+			"\r\nContent-Length: " + strconv.Itoa(len(body)) + "\r\n\r\n" + body,
+		numBytesPerRead: 7,
+	})
+	require.NoError(t, err)
+	return r
+}
+
+func TestDecompressBody(t *testing.T) {
+	data := strings.Repeat("hello world ", 100)
+
+	// Test: gzip body
+	r := compressedRequest(t, "gzip", gzipped(t, data))
+	require.NoError(t, r.DecompressBody(0))
+	body, err := io.ReadAll(r.Body)
+	require.NoError(t, err)
+	assert.Equal(t, data, string(body))
+	assert.Nil(t, r.Headers.Values("Content-Encoding"))
+	assert.Nil(t, r.Headers.Values("Content-Length"))
+
+	// Test: deflate body, which is in the zlib format
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	zw.Write([]byte(data))
+	zw.Close()
+	r = compressedRequest(t, "Deflate", buf.String())
+	require.NoError(t, r.DecompressBody(0))
+	body, err = io.ReadAll(r.Body)
+	require.NoError(t, err)
+	assert.Equal(t, data, string(body))
+
+	// Test: Several codings are undone in reverse order
+	r = compressedRequest(t, "gzip, identity, x-gzip", gzipped(t, gzipped(t, data)))
+	require.NoError(t, r.DecompressBody(0))
+	body, err = io.ReadAll(r.Body)
+	require.NoError(t, err)
+	assert.Equal(t, data, string(body))
+
+	// Test: identity leaves the body alone
+	r = compressedRequest(t, "identity", "plain")
+	require.NoError(t, r.DecompressBody(0))
+	body, err = io.ReadAll(r.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "plain", string(body))
+	assert.Equal(t, "5", r.Headers.Get("Content-Length"))
+
+	// Test: Unknown codings are rejected
+	r = compressedRequest(t, "gzip, br", "whatever")
+	require.ErrorIs(t, r.DecompressBody(0), ErrUnsupportedContentEncoding)
+	assert.Equal(t, "gzip, br", r.Headers.Get("Content-Encoding"))
+
+	// Test: A body that isn't gzip
+	r = compressedRequest(t, "gzip", "not gzip at all")
+	require.NoError(t, r.DecompressBody(0))
+	_, err = io.ReadAll(r.Body)
+	require.ErrorIs(t, err, ErrBadContentEncoding)
+
+	// Test: A truncated body
+	compressed := gzipped(t, data)
+	r = compressedRequest(t, "gzip", compressed[:len(compressed)-10])
+	require.NoError(t, r.DecompressBody(0))
+	_, err = io.ReadAll(r.Body)
+	require.ErrorIs(t, err, ErrBadContentEncoding)
+}
+
+func TestDecompressBodyLimit(t *testing.T) {
+	// Test: A small body that decompresses past the limit
+	bomb := gzipped(t, strings.Repeat("\x00", 10<<20))
+	assert.Less(t, len(bomb), 32<<10)
+	r := compressedRequest(t, "gzip", bomb)
+	require.NoError(t, r.DecompressBody(1<<20))
+	body, err := io.ReadAll(r.Body)
+	require.ErrorIs(t, err, ErrBodyTooLarge)
+	assert.Len(t, body, 1<<20)
+
+	// Test: A body of exactly the limit
+	r = compressedRequest(t, "gzip", gzipped(t, "0123456789"))
+	require.NoError(t, r.DecompressBody(10))
+	body, err = io.ReadAll(r.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "0123456789", string(body))
+}
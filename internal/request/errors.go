@@ -0,0 +1,32 @@
+package request
+
+// ParseError is returned by RequestFromReader, and by reads of Body, when
+// the client sent an invalid request. StatusCode is the status the server
+// should respond with. Use errors.Is with the Err variables below to tell
+// the kinds of errors apart.
+type ParseError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *ParseError) Error() string {
+	return "error: " + e.Message
+}
+
+var (
+	ErrMalformedRequestLine        = &ParseError{StatusCode: 400, Message: "malformed request line"}
+	ErrBadRequestTarget            = &ParseError{StatusCode: 400, Message: "invalid request target"}
+	ErrRequestLineTooLong          = &ParseError{StatusCode: 414, Message: "request line too long"}
+	ErrUnsupportedVersion          = &ParseError{StatusCode: 505, Message: "unsupported HTTP version"}
+	ErrBadHeader                   = &ParseError{StatusCode: 400, Message: "malformed header"}
+	ErrBadContentLength            = &ParseError{StatusCode: 400, Message: "invalid content length"}
+	ErrBadChunkedEncoding          = &ParseError{StatusCode: 400, Message: "malformed chunked body"}
+	ErrUnsupportedTransferEncoding = &ParseError{StatusCode: 501, Message: "unsupported transfer encoding"}
+	ErrUnsupportedContentEncoding  = &ParseError{StatusCode: 415, Message: "unsupported content encoding"}
+	ErrBadContentEncoding          = &ParseError{StatusCode: 400, Message: "malformed compressed body"}
+	ErrBodyTooLarge                = &ParseError{StatusCode: 413, Message: "request body too large"}
+	ErrHeadersTooLarge             = &ParseError{StatusCode: 431, Message: "request headers too large"}
+	ErrBadForm                     = &ParseError{StatusCode: 400, Message: "malformed form data"}
+	ErrTooManyParams               = &ParseError{StatusCode: 400, Message: "too many form parameters"}
+	ErrFormTooLarge                = &ParseError{StatusCode: 413, Message: "form body too large"}
+)
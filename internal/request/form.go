@@ -0,0 +1,176 @@
+package request
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+)
+
+const formContentType = "application/x-www-form-urlencoded"
+
+// Values maps parameter names to their values. The values of one name keep
+// the order they were sent in, but the names themselves are unordered.
+// Names are case-sensitive.
+type Values map[string][]string
+
+// Get returns the first value of key, or "" if there is none.
+func (v Values) Get(key string) string {
+	if len(v[key]) == 0 {
+		return ""
+	}
+	return v[key][0]
+}
+
+func (v Values) Has(key string) bool {
+	_, ok := v[key]
+	return ok
+}
+
+func (v Values) Add(key string, value string) {
+	v[key] = append(v[key], value)
+}
+
+// Set replaces the values of key with value.
+func (v Values) Set(key string, value string) {
+	v[key] = []string{value}
+}
+
+func (v Values) Del(key string) {
+	delete(v, key)
+}
+
+// ParseValues decodes an urlencoded string such as "page=2&sort=asc" into
+// values, decoding percent escapes and "+" as a space. Empty pairs are
+// skipped, and a pair without "=" has an empty value. It fails with
+// ErrBadForm on a malformed escape, or ErrTooManyParams if there are more
+// than maxParams pairs and maxParams isn't 0.
+func ParseValues(s string, maxParams int) (Values, error) {
+	values := Values{}
+	err := parseValuesInto(values, s, maxParams)
+	if err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+func parseValuesInto(values Values, s string, maxParams int) error {
+	count := 0
+	for _, vals := range values {
+		count += len(vals)
+	}
+
+	for _, pair := range strings.Split(s, "&") {
+		if pair == "" {
+			continue
+		}
+
+		count++
+		if maxParams > 0 && count > maxParams {
+			return fmt.Errorf("%w: more than %d", ErrTooManyParams, maxParams)
+		}
+
+		rawKey, rawValue, _ := strings.Cut(pair, "=")
+		key, err := unescapeValue(rawKey)
+		if err != nil {
+			return err
+		}
+		value, err := unescapeValue(rawValue)
+		if err != nil {
+			return err
+		}
+		values.Add(key, value)
+	}
+	return nil
+}
+
+// unescapeValue decodes percent escapes and "+" in s.
+func unescapeValue(s string) (string, error) {
+	if !strings.ContainsAny(s, "%+") {
+		return s, nil
+	}
+
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '+':
+			b.WriteByte(' ')
+		case '%':
+			if i+2 >= len(s) || !isHex(s[i+1]) || !isHex(s[i+2]) {
+				end := min(i+3, len(s))
+				return "", fmt.Errorf("%w: invalid escape %q", ErrBadForm, s[i:end])
+			}
+			b.WriteByte(unhex(s[i+1])<<4 | unhex(s[i+2]))
+			i += 2
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String(), nil
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
+
+// Query returns the parameters of the query string. It is parsed on the
+// first call and the result is kept for later ones.
+func (r *Request) Query() (Values, error) {
+	if r.query == nil && r.queryErr == nil {
+		r.query, r.queryErr = ParseValues(r.RequestLine.Target.RawQuery, r.limits.MaxFormParams)
+	}
+	return r.query, r.queryErr
+}
+
+// Form returns the parameters of an application/x-www-form-urlencoded
+// body followed by those of the query string. Requests with another
+// Content-Type only get the query. The body is read on the first call, so
+// it can't be read again afterwards, and the result is kept for later
+// calls. A body larger than Limits.MaxFormBytes fails with ErrFormTooLarge.
+func (r *Request) Form() (Values, error) {
+	if r.form != nil || r.formErr != nil {
+		return r.form, r.formErr
+	}
+
+	r.form, r.formErr = r.parseForm()
+	return r.form, r.formErr
+}
+
+func (r *Request) parseForm() (Values, error) {
+	form := Values{}
+	mediaType, _, _ := mime.ParseMediaType(r.Headers.Get("Content-Type"))
+	if mediaType == formContentType && r.Body != nil {
+		body := r.Body
+		if r.limits.MaxFormBytes > 0 {
+			body = io.LimitReader(body, r.limits.MaxFormBytes+1)
+		}
+
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return nil, err
+		}
+
+		if r.limits.MaxFormBytes > 0 && int64(len(data)) > r.limits.MaxFormBytes {
+			return nil, fmt.Errorf("%w: more than %d bytes", ErrFormTooLarge, r.limits.MaxFormBytes)
+		}
+
+		err = parseValuesInto(form, string(data), r.limits.MaxFormParams)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := parseValuesInto(form, r.RequestLine.Target.RawQuery, r.limits.MaxFormParams)
+	if err != nil {
+		return nil, err
+	}
+	return form, nil
+}
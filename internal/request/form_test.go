@@ -0,0 +1,120 @@
+package request
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseValues(t *testing.T) {
+	// Test: Several values, decoding and empty pairs
+	values, err := ParseValues("page=2&sort=asc&tag=a+b&tag=c%26d&&flag&empty=&%C3%A9t%C3%A9=%E2%9C%93", 0)
+	require.NoError(t, err)
+	assert.Equal(t, "2", values.Get("page"))
+	assert.Equal(t, []string{"a b", "c&d"}, values["tag"])
+	assert.True(t, values.Has("flag"))
+	assert.Equal(t, "", values.Get("flag"))
+	assert.True(t, values.Has("empty"))
+	assert.Equal(t, "✓", values.Get("été"))
+	assert.False(t, values.Has("missing"))
+	assert.Equal(t, "", values.Get("missing"))
+
+	// Test: An encoded plus is not a space
+	values, err = ParseValues("q=1%2B1", 0)
+	require.NoError(t, err)
+	assert.Equal(t, "1+1", values.Get("q"))
+
+	// Test: Malformed escapes
+	for _, s := range []string{"q=100%", "q=%2", "q=%zz", "%g0=1"} {
+		_, err = ParseValues(s, 0)
+		require.ErrorIs(t, err, ErrBadForm, s)
+	}
+
+	// Test: Too many parameters
+	_, err = ParseValues("a=1&b=2&a=3", 2)
+	require.ErrorIs(t, err, ErrTooManyParams)
+	_, err = ParseValues("a=1&&b=2", 2)
+	require.NoError(t, err)
+}
+
+func TestQuery(t *testing.T) {
+	// Test: The query of the request target
+	r, err := RequestFromReader(&chunkReader{data: "GET /items?page=2&sort=asc HTTP/1.1\r\nHost: localhost\r\n\r\n", numBytesPerRead: 4})
+	require.NoError(t, err)
+	query, err := r.Query()
+	require.NoError(t, err)
+	assert.Equal(t, Values{"page": {"2"}, "sort": {"asc"}}, query)
+
+	// Test: No query
+	r, err = RequestFromReader(&chunkReader{data: "GET /items HTTP/1.1\r\nHost: localhost\r\n\r\n", numBytesPerRead: 4})
+	require.NoError(t, err)
+	query, err = r.Query()
+	require.NoError(t, err)
+	assert.Empty(t, query)
+
+	// Test: Malformed escapes are rejected with the request target
+	_, err = RequestFromReader(&chunkReader{data: "GET /items?page=%2 HTTP/1.1\r\nHost: localhost\r\n\r\n", numBytesPerRead: 4})
+	require.ErrorIs(t, err, ErrBadRequestTarget)
+
+	// Test: Too many parameters, on every call
+	reader := NewReader(&chunkReader{data: "GET /items?a=1&b=2&c=3 HTTP/1.1\r\nHost: localhost\r\n\r\n", numBytesPerRead: 4})
+	reader.Limits = Limits{MaxFormParams: 2}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	_, err = r.Query()
+	require.ErrorIs(t, err, ErrTooManyParams)
+	_, err = r.Query()
+	require.ErrorIs(t, err, ErrTooManyParams)
+}
+
+func formRequest(t *testing.T, limits Limits, target string, contentType string, body string) *Request {
+	t.Helper()
+	reader := NewReader(&chunkReader{
+		data: "POST " + target + " HTTP/1.1\r\nHost: localhost\r\nContent-Type: " + contentType +
+			"\r\nContent-Length: " + strconv.Itoa(len(body)) + "\r\n\r\n" + body,
+		numBytesPerRead: 5,
+	})
+	reader.Limits = limits
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	return r
+}
+
+func TestForm(t *testing.T) {
+	// Test: Body values come before query values
+	r := formRequest(t, DefaultLimits, "/submit?name=query&page=1", "application/x-www-form-urlencoded; charset=utf-8", "name=J%C3%B6rg+M&note=a%2Bb")
+	form, err := r.Form()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Jörg M", "query"}, form["name"])
+	assert.Equal(t, "a+b", form.Get("note"))
+	assert.Equal(t, "1", form.Get("page"))
+
+	// Test: The result is kept once the body has been read
+	again, err := r.Form()
+	require.NoError(t, err)
+	assert.Equal(t, form, again)
+
+	// Test: Other content types only get the query
+	r = formRequest(t, DefaultLimits, "/submit?page=1", "application/json", `{"name":"body"}`)
+	form, err = r.Form()
+	require.NoError(t, err)
+	assert.Equal(t, Values{"page": {"1"}}, form)
+
+	// Test: Malformed body
+	r = formRequest(t, DefaultLimits, "/submit", "application/x-www-form-urlencoded", "name=%E")
+	_, err = r.Form()
+	require.ErrorIs(t, err, ErrBadForm)
+
+	// Test: Body larger than the limit
+	r = formRequest(t, Limits{MaxFormBytes: 10}, "/submit", "application/x-www-form-urlencoded", "name="+strings.Repeat("x", 10))
+	_, err = r.Form()
+	require.ErrorIs(t, err, ErrFormTooLarge)
+
+	// Test: The parameter limit counts the body and the query
+	r = formRequest(t, Limits{MaxFormParams: 2}, "/submit?c=3", "application/x-www-form-urlencoded", "a=1&b=2")
+	_, err = r.Form()
+	require.ErrorIs(t, err, ErrTooManyParams)
+}
@@ -0,0 +1,51 @@
+package request
+
+// Limits bounds the size of the requests read through a Reader. A zero
+// field means no limit.
+type Limits struct {
+	MaxRequestLineBytes int
+	// MaxHeaderBytes bounds the header section, not counting the request
+	// line. It also bounds the trailers of a chunked body.
+	MaxHeaderBytes int
+	MaxHeaderCount int
+	// MaxBodyBytes is copied to Request.MaxBodyBytes, where it can be
+	// changed for a single request before its body is read.
+	MaxBodyBytes int64
+	// MaxFormParams bounds the number of parameters parsed by Query and
+	// Form, counting the query and a form body together.
+	MaxFormParams int
+	// MaxFormBytes bounds the size of a form body read by Form.
+	MaxFormBytes int64
+}
+
+var DefaultLimits = Limits{
+	MaxRequestLineBytes: 8 << 10,
+	MaxHeaderBytes:      64 << 10,
+	MaxHeaderCount:      100,
+	MaxFormParams:       1000,
+	MaxFormBytes:        10 << 20,
+}
+
+const maxChunkSizeLineBytes = 4 << 10
+
+// checkPending checks the part of the request that has been read but not
+// parsed yet, so the buffer doesn't grow past the limits while waiting for
+// the end of a line.
+func (r *Request) checkPending(pending int) error {
+	switch r.state {
+	case requestStateInitialized:
+		if r.limits.MaxRequestLineBytes > 0 && pending > r.limits.MaxRequestLineBytes+len("\r\n") {
+			return ErrRequestLineTooLong
+		}
+
+	case requestStateParsingHeaders:
+		if r.limits.MaxHeaderBytes > 0 && r.headerBytes+pending > r.limits.MaxHeaderBytes {
+			return ErrHeadersTooLarge
+		}
+	}
+	return nil
+}
+
+func (r *Request) bodyTooLarge(size int64) bool {
+	return r.MaxBodyBytes > 0 && size > r.MaxBodyBytes
+}
@@ -0,0 +1,148 @@
+package request
+
+import (
+	"errors"
+	"io"
+)
+
+const bufferSize = 8
+
+// Reader buffers a connection for RequestFromReader. It keeps the bytes
+// that have not been consumed yet, so bytes that arrived together with the
+// headers belong to the body and bytes read past the end of one request are
+// kept for the next one.
+type Reader struct {
+	// Limits applies to every request read through the Reader.
+	Limits Limits
+
+	reader io.Reader
+	data   []byte
+	start  int
+	end    int
+}
+
+func NewReader(reader io.Reader) *Reader {
+	return &Reader{
+		Limits: DefaultLimits,
+		reader: reader,
+		data:   make([]byte, bufferSize),
+	}
+}
+
+func (b *Reader) buffered() []byte {
+	return b.data[b.start:b.end]
+}
+
+func (b *Reader) consume(n int) {
+	b.start += n
+	if b.start == b.end {
+		b.start = 0
+		b.end = 0
+	}
+}
+
+// fill reads more data from the underlying reader, growing the buffer when
+// it is full.
+func (b *Reader) fill() error {
+	if b.start > 0 {
+		copy(b.data, b.data[b.start:b.end])
+		b.end -= b.start
+		b.start = 0
+	}
+
+	if b.end == len(b.data) {
+		newData := make([]byte, len(b.data)*2)
+		copy(newData, b.data[:b.end])
+		b.data = newData
+	}
+
+	n, err := b.reader.Read(b.data[b.end:])
+	b.end += n
+	if n > 0 {
+		return nil
+	}
+	return err
+}
+
+// parseNext calls parse on the buffered data, reading more from the
+// underlying reader until parse consumes something. If more than maxBytes
+// are buffered without parse consuming anything, it returns tooLarge.
+func (b *Reader) parseNext(maxBytes int, tooLarge error, parse func(data []byte) (int, error)) error {
+	for {
+		n, err := parse(b.buffered())
+		if err != nil {
+			return err
+		}
+
+		if n > 0 {
+			b.consume(n)
+			return nil
+		}
+
+		if maxBytes > 0 && len(b.buffered()) > maxBytes {
+			return tooLarge
+		}
+
+		err = b.fill()
+		if errors.Is(err, io.EOF) {
+			return io.ErrUnexpectedEOF
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (b *Reader) Read(p []byte) (int, error) {
+	if b.start == b.end {
+		return b.reader.Read(p)
+	}
+
+	n := copy(p, b.buffered())
+	b.consume(n)
+	return n, nil
+}
+
+type noBody struct{}
+
+func (noBody) Read(p []byte) (int, error) {
+	return 0, io.EOF
+}
+
+// NoBody is the Body of requests that have neither a Content-Length nor a
+// Transfer-Encoding.
+var NoBody io.Reader = noBody{}
+
+// contentLengthReader reads a body of exactly remaining bytes.
+type contentLengthReader struct {
+	src       *Reader
+	req       *Request
+	read      int64
+	remaining int64
+}
+
+func (r *contentLengthReader) Read(p []byte) (int, error) {
+	if r.remaining == 0 {
+		return 0, io.EOF
+	}
+
+	if r.req.bodyTooLarge(r.read + r.remaining) {
+		return 0, ErrBodyTooLarge
+	}
+
+	if int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+
+	n, err := r.src.Read(p)
+	r.read += int64(n)
+	r.remaining -= int64(n)
+	if errors.Is(err, io.EOF) {
+		if r.remaining > 0 {
+			return n, io.ErrUnexpectedEOF
+		}
+		return n, nil
+	}
+	return n, err
+}
@@ -2,7 +2,9 @@ package request
 
 import (
 	"errors"
+	"fmt"
 	"io"
+	"regexp"
 	"strconv"
 	"strings"
 	"unicode"
@@ -12,69 +14,107 @@ import (
 
 type Request struct {
 	RequestLine RequestLine
-	Headers     headers.Headers
-	Body        []byte
+	Headers     *headers.Headers
+	Body        io.Reader
+	Trailers    *headers.Headers
+
+	// MaxBodyBytes is the size of body the request may have, or 0 for no
+	// limit. Reading past it makes Body return ErrBodyTooLarge.
+	MaxBodyBytes int64
+
+	// PathParams holds the path segments captured by the route that
+	// matched the request.
+	PathParams map[string]string
+
+	query    Values
+	queryErr error
+	form     Values
+	formErr  error
+
 	state       int
+	src         *Reader
+	limits      Limits
+	headerBytes int
+	headerCount int
 }
 
 type RequestLine struct {
-	HttpVersion   string
+	HttpVersion string
+	// RequestTarget is the target as it was sent, and Target the same
+	// target parsed.
 	RequestTarget string
+	Target        Target
 	Method        string
 }
 
+var httpVersionPattern = regexp.MustCompile(`^HTTP/[0-9]\.[0-9]$`)
+
 const (
 	requestStateInitialized = iota
 	requestStateParsingHeaders
 	requestStateParsingBody
 	requestStateDone
 )
-const bufferSize = 8
 
+// RequestFromReader parses the request line and headers from reader. The
+// body is not read: Body reads it from reader lazily as the handler
+// consumes it. To read several requests from one connection, pass the same
+// *Reader each time and read each body to the end before the next call.
+// On error, the request only holds the request line, if it was parsed, so
+// the error can be answered in the client's version.
 func RequestFromReader(reader io.Reader) (*Request, error) {
-	buf := make([]byte, bufferSize)
-	readToIndex := 0
-
-	req := Request{state: requestStateInitialized, Headers: headers.NewHeaders()}
+	src, ok := reader.(*Reader)
+	if !ok {
+		src = NewReader(reader)
+	}
+	req := Request{
+		state:        requestStateInitialized,
+		Headers:      headers.NewHeaders(),
+		MaxBodyBytes: src.Limits.MaxBodyBytes,
+		src:          src,
+		limits:       src.Limits,
+	}
 
 	for req.state != requestStateDone {
-		if readToIndex == len(buf) {
-			newBuffer := make([]byte, len(buf)*2, cap(buf)*2)
-			copy(newBuffer, buf)
-			buf = newBuffer
+		numParsed, err := req.parse(src.buffered())
+		if err != nil {
+			return &Request{RequestLine: req.RequestLine}, err
 		}
+		src.consume(numParsed)
 
-		numRead, err := reader.Read(buf[readToIndex:])
-		if errors.Is(err, io.EOF) {
+		if req.state == requestStateDone {
 			break
 		}
 
-		if err != nil {
-			return &Request{}, err
+		if numParsed > 0 {
+			continue
 		}
 
-		readToIndex += numRead
-
-		numParsed, err := req.parse(buf[:readToIndex])
+		err = req.checkPending(len(src.buffered()))
 		if err != nil {
-			return &Request{}, err
+			return &Request{RequestLine: req.RequestLine}, err
+		}
+
+		err = src.fill()
+		if errors.Is(err, io.EOF) {
+			break
 		}
 
-		if numParsed > 0 && numParsed < readToIndex {
-			copy(buf, buf[numParsed:readToIndex])
-			readToIndex -= numParsed
-		} else if numParsed >= readToIndex {
-			// All data was consumed
-			readToIndex = 0
+		if err != nil {
+			return &Request{RequestLine: req.RequestLine}, err
 		}
+	}
 
+	if req.state == requestStateInitialized && len(src.buffered()) == 0 {
+		return &Request{}, io.EOF
 	}
-	if req.state == requestStateParsingHeaders {
-		return &Request{}, errors.New("error: end of headers not found")
+
+	if req.state == requestStateInitialized {
+		return &Request{}, errors.New("error: end of request line not found")
 	}
 
-	if req.state == requestStateParsingBody {
-		return &Request{}, errors.New("error: reported content length not equal to body length")
+	if req.state == requestStateParsingHeaders {
+		return &Request{RequestLine: req.RequestLine}, errors.New("error: end of headers not found")
 	}
 
 	return &req, nil
@@ -88,30 +128,37 @@ func parseRequestLine(s []byte) (*RequestLine, int, error) {
 	line := strings.Split(string(s), "\r\n")[0]
 
 	if len(strings.Split(line, " ")) != 3 {
-		return nil, 0, errors.New("invalid parts of request line")
+		return nil, 0, fmt.Errorf("%w: invalid parts of request line", ErrMalformedRequestLine)
 	}
 
 	parts := strings.Split(line, " ")
 
 	method := parts[0]
 	if method == "" {
-		return nil, 0, errors.New("method is not all uppercase letters")
+		return nil, 0, fmt.Errorf("%w: method is not all uppercase letters", ErrMalformedRequestLine)
 	}
 
 	for _, char := range method {
 		if !unicode.IsUpper(char) {
-			return nil, 0, errors.New("method is not all uppercase letters")
+			return nil, 0, fmt.Errorf("%w: method is not all uppercase letters", ErrMalformedRequestLine)
 		}
 	}
 
 	target := parts[1]
-	if !strings.Contains(target, "/") {
-		return nil, 0, errors.New("invalid target")
+	parsedTarget, err := parseTarget(method, target)
+	if err != nil {
+		return nil, 0, err
 	}
+
 	httpVersion := parts[2]
+	if !httpVersionPattern.MatchString(httpVersion) {
+		return nil, 0, fmt.Errorf("%w: invalid HTTP version", ErrMalformedRequestLine)
+	}
 
-	if httpVersion != "HTTP/1.1" {
-		return nil, 0, errors.New("no support for versions other than HTTP/1.1")
+	// Minor versions are compatible with each other, so a later HTTP/1.x
+	// is served like HTTP/1.1.
+	if !strings.HasPrefix(httpVersion, "HTTP/1.") {
+		return nil, 0, fmt.Errorf("%w: no support for versions other than HTTP/1.x", ErrUnsupportedVersion)
 	}
 
 	version, _ := strings.CutPrefix(httpVersion, "HTTP/")
@@ -119,6 +166,7 @@ func parseRequestLine(s []byte) (*RequestLine, int, error) {
 	return &RequestLine{
 		HttpVersion:   version,
 		RequestTarget: target,
+		Target:        parsedTarget,
 		Method:        method,
 	}, len(line) + len("\r\n"), nil
 }
@@ -153,6 +201,10 @@ func (r *Request) parseSingle(data []byte) (int, error) {
 			return 0, nil
 		}
 
+		if r.limits.MaxRequestLineBytes > 0 && n > r.limits.MaxRequestLineBytes+len("\r\n") {
+			return 0, ErrRequestLineTooLong
+		}
+
 		r.RequestLine = *newRequestLine
 		r.state = requestStateParsingHeaders
 		return n, nil
@@ -160,7 +212,19 @@ func (r *Request) parseSingle(data []byte) (int, error) {
 	case requestStateParsingHeaders:
 		n, done, err := r.Headers.Parse(data)
 		if err != nil {
-			return 0, err
+			return 0, fmt.Errorf("%w: %w", ErrBadHeader, err)
+		}
+
+		r.headerBytes += n
+		if r.limits.MaxHeaderBytes > 0 && r.headerBytes > r.limits.MaxHeaderBytes {
+			return 0, ErrHeadersTooLarge
+		}
+
+		if n > 0 && !done {
+			r.headerCount++
+			if r.limits.MaxHeaderCount > 0 && r.headerCount > r.limits.MaxHeaderCount {
+				return 0, fmt.Errorf("%w: too many headers", ErrHeadersTooLarge)
+			}
 		}
 
 		if done {
@@ -170,28 +234,38 @@ func (r *Request) parseSingle(data []byte) (int, error) {
 		return n, nil
 
 	case requestStateParsingBody:
-		contentLength := r.Headers.Get("Content-Length")
-		if contentLength == "" {
-			if len(data) > 0 {
-				return 0, errors.New("error: body exists but no reported content length")
-			}
+		chunked, err := r.isChunked()
+		if err != nil {
+			return 0, err
+		}
+
+		if chunked {
+			r.Trailers = headers.NewHeaders()
+			r.Body = &chunkedReader{src: r.src, req: r, trailers: r.Trailers}
 			r.state = requestStateDone
 			return 0, nil
 		}
 
-		r.Body = data
-		length, err := strconv.Atoi(contentLength)
-		if err != nil {
-			return 0, errors.New("error: reported content length is not a number")
+		contentLength := r.Headers.Values("Content-Length")
+		if contentLength == nil {
+			r.Body = NoBody
+			r.state = requestStateDone
+			return 0, nil
 		}
-		if len(data) > length {
-			return 0, errors.New("error: length of data is greater than content length")
+
+		for _, value := range contentLength[1:] {
+			if value != contentLength[0] {
+				return 0, fmt.Errorf("%w: conflicting content lengths", ErrBadContentLength)
+			}
 		}
 
-		if len(data) == length {
-			r.state = requestStateDone
-			return len(data), nil
+		length, err := strconv.ParseUint(contentLength[0], 10, 63)
+		if err != nil {
+			return 0, fmt.Errorf("%w: reported content length is not a number", ErrBadContentLength)
 		}
+
+		r.Body = &contentLengthReader{src: r.src, req: r, remaining: int64(length)}
+		r.state = requestStateDone
 		return 0, nil
 
 	case requestStateDone:
@@ -201,3 +275,22 @@ func (r *Request) parseSingle(data []byte) (int, error) {
 		return 0, errors.New("error: unknown state")
 	}
 }
+
+// KeepAlive reports whether the client allows the connection to be reused
+// after this request.
+func (r *Request) KeepAlive() bool {
+	if r.Headers.HasToken("Connection", "close") {
+		return false
+	}
+
+	if r.RequestLine.HttpVersion == "1.0" {
+		return r.Headers.HasToken("Connection", "keep-alive")
+	}
+	return true
+}
+
+// PathValue returns the path segment captured as name by the route that
+// matched the request, or "" if there is none.
+func (r *Request) PathValue(name string) string {
+	return r.PathParams[name]
+}
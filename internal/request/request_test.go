@@ -2,6 +2,7 @@ package request
 
 import (
 	"io"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -94,6 +95,26 @@ func TestRequestLineParse(t *testing.T) {
 	}
 	_, err = RequestFromReader(reader)
 	require.Error(t, err)
+
+	// Test: HTTP/1.0 without a Host
+	reader = &chunkReader{
+		data:            "GET /status HTTP/1.0\r\nUser-Agent: ApacheBench/2.3\r\n\r\n",
+		numBytesPerRead: 4,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "1.0", r.RequestLine.HttpVersion)
+	assert.False(t, r.KeepAlive())
+
+	// Test: Later HTTP/1.x minor versions
+	reader = &chunkReader{
+		data:            "GET / HTTP/1.2\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 4,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "1.2", r.RequestLine.HttpVersion)
+	assert.True(t, r.KeepAlive())
 }
 
 func TestHeadersParse(t *testing.T) {
@@ -106,9 +127,9 @@ func TestHeadersParse(t *testing.T) {
 	r, err := RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "localhost:42069", r.Headers["host"])
-	assert.Equal(t, "curl/7.81.0", r.Headers["user-agent"])
-	assert.Equal(t, "*/*", r.Headers["accept"])
+	assert.Equal(t, "localhost:42069", r.Headers.Get("host"))
+	assert.Equal(t, "curl/7.81.0", r.Headers.Get("user-agent"))
+	assert.Equal(t, "*/*", r.Headers.Get("accept"))
 
 	// Test: Malformed Header
 	reader = &chunkReader{
@@ -138,8 +159,8 @@ func TestHeadersParse(t *testing.T) {
 	r, err = RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "bob, sam", r.Headers["user-agent"])
-	assert.Equal(t, "bob", r.Headers["thatguy"])
+	assert.Equal(t, []string{"bob", "sam"}, r.Headers.Values("user-agent"))
+	assert.Equal(t, "bob", r.Headers.Get("thatguy"))
 
 	// Test: Case Insensitive Headers
 	reader = &chunkReader{
@@ -149,8 +170,8 @@ func TestHeadersParse(t *testing.T) {
 	r, err = RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "bob, sam", r.Headers["user-agent"])
-	assert.Equal(t, "bob", r.Headers["thatguy"])
+	assert.Equal(t, []string{"bob", "sam"}, r.Headers.Values("user-agent"))
+	assert.Equal(t, "bob", r.Headers.Get("thatguy"))
 
 	// Test: Missing End of Headers
 	reader = &chunkReader{
@@ -175,7 +196,9 @@ func TestRequestBody(t *testing.T) {
 	r, err := RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "hello world!\n", string(r.Body))
+	body, err := io.ReadAll(r.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "hello world!\n", string(body))
 
 	// Test: Body shorter than reported content length
 	reader = &chunkReader{
@@ -186,7 +209,9 @@ func TestRequestBody(t *testing.T) {
 			"partial content",
 		numBytesPerRead: 3,
 	}
-	_, err = RequestFromReader(reader)
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	_, err = io.ReadAll(r.Body)
 	require.Error(t, err)
 
 	// Test: Empty Body, 0 reported content length (valid)
@@ -199,7 +224,9 @@ func TestRequestBody(t *testing.T) {
 	}
 	r, err = RequestFromReader(reader)
 	require.NoError(t, err)
-	assert.Equal(t, []byte(""), r.Body)
+	body, err = io.ReadAll(r.Body)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{}, body)
 
 	// Test: Empty Body, no reported content length (valid)
 	reader = &chunkReader{
@@ -210,16 +237,353 @@ func TestRequestBody(t *testing.T) {
 	}
 	r, err = RequestFromReader(reader)
 	require.NoError(t, err)
-	assert.Equal(t, []byte(nil), r.Body)
+	assert.Equal(t, NoBody, r.Body)
 
 	// Test: No Content-Length but Body Exists
-	reader = &chunkReader{
+	shared := NewReader(&chunkReader{
 		data: "POST /submit HTTP/1.1\r\n" +
 			"Host: localhost:42069\r\n" +
 			"\r\n" +
 			"the body",
+		numBytesPerRead: 64,
+	})
+	r, err = RequestFromReader(shared)
+	require.NoError(t, err)
+	assert.Equal(t, NoBody, r.Body)
+	_, err = RequestFromReader(shared)
+	require.Error(t, err)
+}
+
+func TestPipelinedRequests(t *testing.T) {
+	// Test: Bytes past the end of a request are kept for the next one
+	reader := NewReader(&chunkReader{
+		data: "POST /first HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Content-Length: 5\r\n" +
+			"\r\n" +
+			"hello" +
+			"GET /second HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"\r\n",
+		numBytesPerRead: 7,
+	})
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "/first", r.RequestLine.RequestTarget)
+	body, err := io.ReadAll(r.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(body))
+
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "/second", r.RequestLine.RequestTarget)
+	assert.Equal(t, NoBody, r.Body)
+
+	// Test: Clean end of connection between requests
+	_, err = RequestFromReader(reader)
+	require.ErrorIs(t, err, io.EOF)
+
+	// Test: Connection header
+	reader = NewReader(&chunkReader{
+		data:            "GET / HTTP/1.1\r\nConnection: close\r\n\r\n",
+		numBytesPerRead: 64,
+	})
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.False(t, r.KeepAlive())
+}
+
+func TestChunkedRequestBody(t *testing.T) {
+	// Test: Standard chunked body
+	reader := &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"6\r\n" +
+			"hello \r\n" +
+			"7\r\n" +
+			"world!\n\r\n" +
+			"0\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	body, err := io.ReadAll(r.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "hello world!\n", string(body))
+
+	// Test: Chunk extensions and trailers
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"a;name=value;flag\r\n" +
+			"0123456789\r\n" +
+			"0\r\n" +
+			"X-Checksum: abc123\r\n" +
+			"\r\n",
+		numBytesPerRead: 1,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	body, err = io.ReadAll(r.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "0123456789", string(body))
+	assert.Equal(t, "abc123", r.Trailers.Get("X-Checksum"))
+
+	// Test: Empty chunked body
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"0\r\n" +
+			"\r\n",
+		numBytesPerRead: 4,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	body, err = io.ReadAll(r.Body)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{}, body)
+
+	// Test: Missing last chunk
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"5\r\n" +
+			"hello\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	_, err = io.ReadAll(r.Body)
+	require.Error(t, err)
+
+	// Test: Invalid chunk size
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"zz\r\n" +
+			"hello\r\n" +
+			"0\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	_, err = io.ReadAll(r.Body)
+	require.Error(t, err)
+
+	// Test: Chunk data longer than chunk size
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"3\r\n" +
+			"hello\r\n" +
+			"0\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	_, err = io.ReadAll(r.Body)
+	require.Error(t, err)
+
+	// Test: Both Transfer-Encoding and Content-Length
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"Content-Length: 5\r\n" +
+			"\r\n" +
+			"5\r\n" +
+			"hello\r\n" +
+			"0\r\n" +
+			"\r\n",
 		numBytesPerRead: 3,
 	}
 	_, err = RequestFromReader(reader)
 	require.Error(t, err)
 }
+
+func TestStreamingRequestBody(t *testing.T) {
+	// Test: Headers are returned before the body has arrived
+	pr, pw := io.Pipe()
+	go func() {
+		pw.Write([]byte("POST /upload HTTP/1.1\r\nHost: localhost:42069\r\nContent-Length: 10\r\n\r\n"))
+		pw.Write([]byte("hello"))
+		pw.Write([]byte("world"))
+		pw.Close()
+	}()
+
+	r, err := RequestFromReader(pr)
+	require.NoError(t, err)
+	assert.Equal(t, "/upload", r.RequestLine.RequestTarget)
+
+	body, err := io.ReadAll(r.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "helloworld", string(body))
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		data       string
+		kind       error
+		statusCode int
+	}{
+		{
+			name:       "Malformed request line",
+			data:       "GET /\r\n\r\n",
+			kind:       ErrMalformedRequestLine,
+			statusCode: 400,
+		},
+		{
+			name:       "Unsupported version",
+			data:       "GET / HTTP/2.0\r\n\r\n",
+			kind:       ErrUnsupportedVersion,
+			statusCode: 505,
+		},
+		{
+			name:       "HTTP/0.9",
+			data:       "GET / HTTP/0.9\r\n\r\n",
+			kind:       ErrUnsupportedVersion,
+			statusCode: 505,
+		},
+		{
+			name:       "Malformed version",
+			data:       "GET / HTTP/one\r\n\r\n",
+			kind:       ErrMalformedRequestLine,
+			statusCode: 400,
+		},
+		{
+			name:       "Bad header",
+			data:       "GET / HTTP/1.1\r\nHost localhost\r\n\r\n",
+			kind:       ErrBadHeader,
+			statusCode: 400,
+		},
+		{
+			name:       "Control character in header value",
+			data:       "GET / HTTP/1.1\r\nX-Test: a\x00b\r\n\r\n",
+			kind:       ErrBadHeader,
+			statusCode: 400,
+		},
+		{
+			name:       "Bad content length",
+			data:       "POST / HTTP/1.1\r\nContent-Length: -1\r\n\r\n",
+			kind:       ErrBadContentLength,
+			statusCode: 400,
+		},
+		{
+			name:       "Conflicting content lengths",
+			data:       "POST / HTTP/1.1\r\nContent-Length: 5\r\nContent-Length: 6\r\n\r\nhello",
+			kind:       ErrBadContentLength,
+			statusCode: 400,
+		},
+		{
+			name:       "Unsupported transfer encoding",
+			data:       "POST / HTTP/1.1\r\nTransfer-Encoding: gzip\r\n\r\n",
+			kind:       ErrUnsupportedTransferEncoding,
+			statusCode: 501,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := RequestFromReader(&chunkReader{data: tt.data, numBytesPerRead: 4})
+			require.ErrorIs(t, err, tt.kind)
+
+			var parseErr *ParseError
+			require.ErrorAs(t, err, &parseErr)
+			assert.Equal(t, tt.statusCode, parseErr.StatusCode)
+		})
+	}
+}
+
+func TestRequestLimits(t *testing.T) {
+	limits := Limits{
+		MaxRequestLineBytes: 32,
+		MaxHeaderBytes:      64,
+		MaxHeaderCount:      3,
+		MaxBodyBytes:        10,
+	}
+	newReader := func(data string) *Reader {
+		reader := NewReader(&chunkReader{data: data, numBytesPerRead: 5})
+		reader.Limits = limits
+		return reader
+	}
+
+	// Test: Request line too long, before the end of the line arrives
+	_, err := RequestFromReader(newReader("GET /" + strings.Repeat("a", 100)))
+	require.ErrorIs(t, err, ErrRequestLineTooLong)
+
+	// Test: Header section too large, keeping the request line
+	r, err := RequestFromReader(newReader("GET / HTTP/1.0\r\nX-Big: " + strings.Repeat("b", 100) + "\r\n\r\n"))
+	require.ErrorIs(t, err, ErrHeadersTooLarge)
+	assert.Equal(t, "1.0", r.RequestLine.HttpVersion)
+	assert.Nil(t, r.Headers)
+
+	// Test: Too many headers
+	_, err = RequestFromReader(newReader("GET / HTTP/1.1\r\nA: 1\r\nB: 2\r\nC: 3\r\nD: 4\r\n\r\n"))
+	require.ErrorIs(t, err, ErrHeadersTooLarge)
+
+	// Test: Within limits
+	r, err = RequestFromReader(newReader("GET / HTTP/1.1\r\nA: 1\r\nB: 2\r\nC: 3\r\n\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "3", r.Headers.Get("C"))
+
+	// Test: Content-Length over the body limit
+	r, err = RequestFromReader(newReader("POST / HTTP/1.1\r\nContent-Length: 11\r\n\r\nhello world"))
+	require.NoError(t, err)
+	_, err = io.ReadAll(r.Body)
+	require.ErrorIs(t, err, ErrBodyTooLarge)
+
+	// Test: Chunked body over the body limit
+	r, err = RequestFromReader(newReader("POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n" +
+		"6\r\nhello \r\n6\r\nworld!\r\n0\r\n\r\n"))
+	require.NoError(t, err)
+	body, err := io.ReadAll(r.Body)
+	require.ErrorIs(t, err, ErrBodyTooLarge)
+	assert.Equal(t, "hello ", string(body))
+
+	// Test: Raising the body limit for one request
+	r, err = RequestFromReader(newReader("POST / HTTP/1.1\r\nContent-Length: 11\r\n\r\nhello world"))
+	require.NoError(t, err)
+	r.MaxBodyBytes = 20
+	body, err = io.ReadAll(r.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", string(body))
+
+	// Test: Trailer section over the size limit, each line within it
+	chunked := "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n0\r\n"
+	r, err = RequestFromReader(newReader(chunked + strings.Repeat("X-T: "+strings.Repeat("t", 33)+"\r\n", 2) + "\r\n"))
+	require.NoError(t, err)
+	_, err = io.ReadAll(r.Body)
+	require.ErrorIs(t, err, ErrHeadersTooLarge)
+
+	// Test: Too many trailers
+	r, err = RequestFromReader(newReader(chunked + "A: 1\r\nB: 2\r\nC: 3\r\nD: 4\r\n\r\n"))
+	require.NoError(t, err)
+	_, err = io.ReadAll(r.Body)
+	require.ErrorIs(t, err, ErrHeadersTooLarge)
+
+	// Test: Trailers within limits
+	r, err = RequestFromReader(newReader(chunked + "A: 1\r\nB: 2\r\nC: 3\r\n\r\n"))
+	require.NoError(t, err)
+	body, err = io.ReadAll(r.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(body))
+	assert.Equal(t, "3", r.Trailers.Get("C"))
+}
@@ -0,0 +1,185 @@
+package request
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// TargetForm is one of the four forms of request target in RFC 9112.
+type TargetForm int
+
+const (
+	// OriginForm is a path with an optional query, like "/search?q=go".
+	OriginForm TargetForm = iota
+	// AbsoluteForm is a whole URI, as sent to proxies, like
+	// "http://example.com/search?q=go".
+	AbsoluteForm
+	// AuthorityForm is a host and port, like "example.com:443". Only
+	// CONNECT requests use it.
+	AuthorityForm
+	// AsteriskForm is "*". Only OPTIONS requests for the whole server use
+	// it.
+	AsteriskForm
+)
+
+// Target is a parsed request target.
+type Target struct {
+	Form TargetForm
+	// Scheme is set for the absolute form, in lower case.
+	Scheme string
+	// Host is the authority of the absolute and authority forms, such as
+	// "example.com:8080".
+	Host string
+	// Path is the percent-decoded path of the origin and absolute forms.
+	// An absolute form without a path has the path "/".
+	Path string
+	// RawPath is Path as it was sent, still percent-encoded, so encoded
+	// slashes can be told apart from separators.
+	RawPath string
+	// RawQuery is the query without its "?", still encoded.
+	RawQuery string
+}
+
+// parseTarget parses the target of a request for method, checking that
+// its form is allowed for the method.
+func parseTarget(method string, target string) (Target, error) {
+	if method == "CONNECT" {
+		if !validAuthority(target, true) {
+			return Target{}, fmt.Errorf("%w: CONNECT needs a host and port", ErrBadRequestTarget)
+		}
+		return Target{Form: AuthorityForm, Host: target}, nil
+	}
+
+	if target == "*" {
+		if method != "OPTIONS" {
+			return Target{}, fmt.Errorf("%w: * is only allowed for OPTIONS", ErrBadRequestTarget)
+		}
+		return Target{Form: AsteriskForm}, nil
+	}
+
+	if strings.HasPrefix(target, "/") {
+		t, err := parsePathAndQuery(target)
+		t.Form = OriginForm
+		return t, err
+	}
+
+	scheme, rest, found := strings.Cut(target, "://")
+	if !found || !validScheme(scheme) {
+		return Target{}, fmt.Errorf("%w: %q is not a path or absolute URI", ErrBadRequestTarget, target)
+	}
+
+	end := strings.IndexAny(rest, "/?")
+	if end == -1 {
+		end = len(rest)
+	}
+	host := rest[:end]
+	if !validAuthority(host, false) {
+		return Target{}, fmt.Errorf("%w: invalid host %q", ErrBadRequestTarget, host)
+	}
+
+	pathAndQuery := rest[end:]
+	if !strings.HasPrefix(pathAndQuery, "/") {
+		pathAndQuery = "/" + pathAndQuery
+	}
+
+	t, err := parsePathAndQuery(pathAndQuery)
+	t.Form = AbsoluteForm
+	t.Scheme = strings.ToLower(scheme)
+	t.Host = host
+	return t, err
+}
+
+func parsePathAndQuery(s string) (Target, error) {
+	rawPath, rawQuery, _ := strings.Cut(s, "?")
+	if !validURIChars(rawPath, "/") || !validURIChars(rawQuery, "/?") {
+		return Target{}, fmt.Errorf("%w: invalid characters in %q", ErrBadRequestTarget, s)
+	}
+
+	path, err := url.PathUnescape(rawPath)
+	if err != nil {
+		return Target{}, fmt.Errorf("%w: %w", ErrBadRequestTarget, err)
+	}
+
+	return Target{Path: path, RawPath: rawPath, RawQuery: rawQuery}, nil
+}
+
+// validURIChars reports whether s is made of pchars, as defined by RFC
+// 3986, and the characters in extra. Percent signs must start a valid
+// escape.
+func validURIChars(s string, extra string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '%':
+			if i+2 >= len(s) || !isHex(s[i+1]) || !isHex(s[i+2]) {
+				return false
+			}
+			i += 2
+		case isUnreserved(c) || strings.IndexByte("!$&'()*+,;=:@", c) != -1:
+		case strings.IndexByte(extra, c) != -1:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.IndexByte("-._~", c) != -1
+}
+
+func validScheme(scheme string) bool {
+	if scheme == "" {
+		return false
+	}
+
+	for i := 0; i < len(scheme); i++ {
+		c := scheme[i]
+		letter := 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+		if !letter && (i == 0 || !('0' <= c && c <= '9' || c == '+' || c == '-' || c == '.')) {
+			return false
+		}
+	}
+	return true
+}
+
+// validAuthority reports whether s is a host with an optional port, or a
+// required one if needPort is set. User info is not allowed.
+func validAuthority(s string, needPort bool) bool {
+	host, port := s, ""
+	if strings.HasPrefix(s, "[") {
+		end := strings.IndexByte(s, ']')
+		if end == -1 {
+			return false
+		}
+		host = s[1:end]
+		rest := s[end+1:]
+		if rest != "" {
+			if rest[0] != ':' {
+				return false
+			}
+			port = rest[1:]
+		}
+		if host == "" || !validURIChars(host, "") || strings.Trim(host, "0123456789abcdefABCDEF:.") != "" {
+			return false
+		}
+	} else {
+		i := strings.LastIndexByte(s, ':')
+		if i != -1 {
+			host, port = s[:i], s[i+1:]
+		}
+		if host == "" || strings.ContainsAny(host, ":@") || !validURIChars(host, "") {
+			return false
+		}
+	}
+
+	if needPort && port == "" {
+		return false
+	}
+	return strings.Trim(port, "0123456789") == "" && len(port) <= 5
+}
@@ -1,35 +1,214 @@
 package response
 
 import (
-	"fmt"
+	"errors"
+	"io"
+	"net"
+	"strconv"
 
 	"github.com/sambakker4/httpfromtcp/internal/headers"
 )
 
-func (w *Writer) WriteChunkedBody(p []byte) (int, error) {
-	hex := fmt.Sprintf("%X", len(p))
-	n, err := w.Write([]byte(fmt.Sprintf("%s\r\n%s\r\n", hex, string(p))))
-	if err != nil {
-		return 0, err
+var crlf = []byte("\r\n")
+
+// copyChunkSize is the largest chunk copied into a single write with its
+// size line and CRLF. Larger chunks are passed through as is, since
+// net.Buffers only merges the three writes on a raw TCP connection.
+const copyChunkSize = 4 << 10
+
+// ChunkedWriter encodes a body with the chunked transfer coding as it is
+// written. Close writes the last chunk followed by the trailers, so a body
+// can be streamed with io.Copy and closed.
+type ChunkedWriter struct {
+	// MaxChunkSize splits writes into chunks of at most this many bytes.
+	// With 0, every Write is sent as one chunk.
+	MaxChunkSize int
+
+	// Trailers are written by Close after the last chunk.
+	Trailers *headers.Headers
+
+	w         io.Writer
+	sizeLine  [18]byte
+	buf       []byte
+	lastChunk bool
+	closed    bool
+}
+
+func NewChunkedWriter(w io.Writer) *ChunkedWriter {
+	return &ChunkedWriter{w: w}
+}
+
+// Write writes p as one or more chunks. Small chunks are sent in a single
+// write, while the data of larger ones is written as is, between its size
+// line and CRLF, without being copied.
+func (c *ChunkedWriter) Write(p []byte) (int, error) {
+	if c.lastChunk {
+		return 0, errors.New("error: writing after the last chunk")
+	}
+
+	written := 0
+	for len(p) > 0 {
+		chunk := p
+		if c.MaxChunkSize > 0 && len(chunk) > c.MaxChunkSize {
+			chunk = chunk[:c.MaxChunkSize]
+		}
+
+		var err error
+		if len(chunk) <= copyChunkSize {
+			c.buf = strconv.AppendInt(c.buf[:0], int64(len(chunk)), 16)
+			c.buf = append(c.buf, crlf...)
+			c.buf = append(c.buf, chunk...)
+			c.buf = append(c.buf, crlf...)
+			_, err = c.w.Write(c.buf)
+		} else {
+			sizeLine := strconv.AppendInt(c.sizeLine[:0], int64(len(chunk)), 16)
+			sizeLine = append(sizeLine, crlf...)
+			bufs := net.Buffers{sizeLine, chunk, crlf}
+			_, err = bufs.WriteTo(c.w)
+		}
+		if err != nil {
+			return written, err
+		}
+
+		written += len(chunk)
+		p = p[len(chunk):]
 	}
-	return n, nil
+	return written, nil
 }
 
-func (w *Writer) WriteChunkedBodyDone() (int, error) {
-	n, err := w.Write([]byte("0\r\n"))
+func (c *ChunkedWriter) writeLastChunk() error {
+	if c.lastChunk {
+		return nil
+	}
+
+	_, err := c.w.Write([]byte("0\r\n"))
 	if err != nil {
-		return 0, err
+		return err
 	}
-	return n, nil
+	c.lastChunk = true
+	return nil
 }
 
-func (w *Writer) WriteTrailers(h headers.Headers) error {
-	for key, val := range h {
-		_, err := w.Write([]byte(fmt.Sprintf("%s: %s\r\n", key, val)))
+// Close ends the body with the last chunk and the trailers. Closing again
+// does nothing.
+func (c *ChunkedWriter) Close() error {
+	if c.closed {
+		return nil
+	}
+
+	if c.Trailers != nil {
+		err := c.Trailers.Validate()
 		if err != nil {
 			return err
 		}
 	}
-	w.Write([]byte("\r\n"))
+
+	err := c.writeLastChunk()
+	if err != nil {
+		return err
+	}
+
+	if c.Trailers != nil {
+		for key, val := range c.Trailers.All() {
+			_, err := c.w.Write([]byte(key + ": " + val + "\r\n"))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err = c.w.Write(crlf)
+	if err != nil {
+		return err
+	}
+	c.closed = true
 	return nil
 }
+
+// connWriter writes to the connection through the Writer, so HEAD
+// responses still discard the body.
+type connWriter struct {
+	w *Writer
+}
+
+func (c connWriter) Write(p []byte) (int, error) {
+	return c.w.write(p)
+}
+
+// chunkedWriter returns the encoder for the body, creating it for
+// handlers that frame the body themselves.
+func (w *Writer) chunkedWriter() *ChunkedWriter {
+	if w.chunks == nil {
+		w.chunks = NewChunkedWriter(connWriter{w})
+		w.chunks.MaxChunkSize = w.MaxChunkSize
+	}
+	return w.chunks
+}
+
+// bodyWriter returns where the body goes on the wire: the chunked encoder
+// for HTTP/1.1, or the connection itself for HTTP/1.0, which has no
+// chunked encoding.
+func (w *Writer) bodyWriter() io.Writer {
+	if w.http10() {
+		return connWriter{w}
+	}
+	return w.chunkedWriter()
+}
+
+func (w *Writer) WriteChunkedBody(p []byte) (int, error) {
+	if w.state != writerStateBody {
+		return 0, errors.New("error: writing request in the wrong order")
+	}
+
+	if !w.StatusCode.BodyAllowed() {
+		return 0, errors.New("error: status code does not allow a body")
+	}
+
+	writer := w.bodyWriter()
+	if enc := w.bodyEncoder(); enc != nil {
+		writer = enc
+	}
+
+	n, err := writer.Write(p)
+	w.bytesWritten += int64(n)
+	return n, err
+}
+
+func (w *Writer) WriteChunkedBodyDone() (int, error) {
+	err := w.closeEncoder()
+	if err != nil {
+		return 0, err
+	}
+
+	if w.http10() {
+		return 0, nil
+	}
+
+	err = w.chunkedWriter().writeLastChunk()
+	if err != nil {
+		return 0, err
+	}
+	return len("0\r\n"), nil
+}
+
+// WriteTrailers ends a chunked body with trailers, writing the last chunk
+// first if it hasn't been written. Every trailer must have been declared.
+// HTTP/1.0 responses end without them.
+func (w *Writer) WriteTrailers(h *headers.Headers) error {
+	if w.http10() {
+		return w.closeEncoder()
+	}
+
+	err := w.checkTrailers(h)
+	if err != nil {
+		return err
+	}
+
+	err = w.closeEncoder()
+	if err != nil {
+		return err
+	}
+
+	w.chunks.Trailers = h
+	return w.chunks.Close()
+}
@@ -0,0 +1,100 @@
+package response
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/sambakker4/httpfromtcp/internal/headers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordWriter keeps every slice it is given.
+type recordWriter struct {
+	writes [][]byte
+}
+
+func (r *recordWriter) Write(p []byte) (int, error) {
+	r.writes = append(r.writes, p)
+	return len(p), nil
+}
+
+func TestChunkedWriter(t *testing.T) {
+	// Test: io.Copy, split by the chunk size, with trailers on Close
+	buf := &bytes.Buffer{}
+	c := NewChunkedWriter(buf)
+	c.MaxChunkSize = 10
+	c.Trailers = headers.NewHeaders()
+	c.Trailers.Set("X-Checksum", "abc")
+
+	n, err := io.Copy(c, strings.NewReader("hello world, in chunks"))
+	require.NoError(t, err)
+	assert.Equal(t, int64(22), n)
+	require.NoError(t, c.Close())
+	assert.Equal(t, "a\r\nhello worl\r\n"+
+		"a\r\nd, in chun\r\n"+
+		"2\r\nks\r\n"+
+		"0\r\n"+
+		"X-Checksum: abc\r\n"+
+		"\r\n", buf.String())
+
+	// Test: Closing again writes nothing, writing fails
+	require.NoError(t, c.Close())
+	_, err = c.Write([]byte("late"))
+	require.Error(t, err)
+	assert.True(t, strings.HasSuffix(buf.String(), "abc\r\n\r\n"))
+
+	// Test: Empty writes don't end the body
+	buf = &bytes.Buffer{}
+	c = NewChunkedWriter(buf)
+	n2, err := c.Write(nil)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n2)
+	require.NoError(t, c.Close())
+	assert.Equal(t, "0\r\n\r\n", buf.String())
+
+	// Test: Small chunks are sent in a single write
+	rec := &recordWriter{}
+	c = NewChunkedWriter(rec)
+	_, err = c.Write([]byte("payload"))
+	require.NoError(t, err)
+	require.Len(t, rec.writes, 1)
+	assert.Equal(t, "7\r\npayload\r\n", string(rec.writes[0]))
+
+	// Test: Large chunk data is passed through without being copied
+	rec = &recordWriter{}
+	data := bytes.Repeat([]byte("x"), copyChunkSize+1)
+	c = NewChunkedWriter(rec)
+	_, err = c.Write(data)
+	require.NoError(t, err)
+	require.Len(t, rec.writes, 3)
+	assert.Equal(t, "1001\r\n", string(rec.writes[0]))
+	assert.Same(t, &data[0], &rec.writes[1][0])
+	assert.Equal(t, "\r\n", string(rec.writes[2]))
+
+	// Test: Invalid trailers are rejected before the last chunk
+	buf = &bytes.Buffer{}
+	c = NewChunkedWriter(buf)
+	c.Trailers = headers.NewHeaders()
+	c.Trailers.Set("X-Bad", "a\nb")
+	require.Error(t, c.Close())
+	assert.Equal(t, 0, buf.Len())
+}
+
+func TestWriterChunkSize(t *testing.T) {
+	// Test: The Writer splits a chunked body by its MaxChunkSize
+	buf := &bytes.Buffer{}
+	w := &Writer{Writer: buf, MaxChunkSize: 4}
+	w.Headers().Set("Transfer-Encoding", "chunked")
+	_, err := w.Write([]byte("abcdef"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Transfer-Encoding: chunked\r\n"+
+		"\r\n"+
+		"4\r\nabcd\r\n"+
+		"2\r\nef\r\n"+
+		"0\r\n\r\n", buf.String())
+}
@@ -0,0 +1,244 @@
+package response
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/sambakker4/httpfromtcp/internal/headers"
+)
+
+// Compression configures how a response body is compressed.
+type Compression struct {
+	// Encoding is "gzip", "deflate" or "" to send the body as is, as
+	// returned by NegotiateEncoding.
+	Encoding string
+	// Level is a compress/flate level, such as flate.DefaultCompression.
+	Level int
+	// MinSize is the smallest body worth compressing, when its length is
+	// known before the headers are sent.
+	MinSize int
+}
+
+// compression is the state of a response's compression.
+type compression struct {
+	Compression
+	decided bool
+	encoder encoder
+}
+
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// incompressibleTypes are media types that are compressed already.
+var incompressibleTypes = []string{
+	"application/gzip",
+	"application/pdf",
+	"application/vnd.rar",
+	"application/x-7z-compressed",
+	"application/x-bzip2",
+	"application/x-gzip",
+	"application/x-rar-compressed",
+	"application/x-xz",
+	"application/zip",
+	"application/zstd",
+	"font/woff",
+	"font/woff2",
+}
+
+// compressible reports whether a body of contentType is worth compressing.
+func compressible(contentType string) bool {
+	mediaType, _, _ := strings.Cut(strings.ToLower(contentType), ";")
+	mediaType = strings.TrimSpace(mediaType)
+	if mediaType == "image/svg+xml" {
+		return true
+	}
+
+	for _, prefix := range []string{"image/", "video/", "audio/"} {
+		if strings.HasPrefix(mediaType, prefix) {
+			return false
+		}
+	}
+
+	for _, t := range incompressibleTypes {
+		if mediaType == t {
+			return false
+		}
+	}
+	return true
+}
+
+// NegotiateEncoding picks the content coding for a response from an
+// Accept-Encoding value: "gzip" or "deflate", whichever has the highest
+// q-value, or "" if neither is acceptable. gzip wins ties.
+func NegotiateEncoding(acceptEncoding string) string {
+	quality := map[string]float64{}
+	for _, item := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(item, ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding == "" {
+			continue
+		}
+		if coding == "x-gzip" {
+			coding = "gzip"
+		}
+
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			name, value, found := strings.Cut(param, "=")
+			if !found || strings.ToLower(strings.TrimSpace(name)) != "q" {
+				continue
+			}
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil || parsed < 0 || parsed > 1 {
+				parsed = 0
+			}
+			q = parsed
+		}
+		quality[coding] = q
+	}
+
+	best, bestQ := "", 0.0
+	for _, coding := range []string{"gzip", "deflate"} {
+		q, ok := quality[coding]
+		if !ok {
+			q, ok = quality["*"]
+		}
+		if ok && q > bestQ {
+			best, bestQ = coding, q
+		}
+	}
+	return best
+}
+
+// Compress compresses the body with c.Encoding when the headers are sent,
+// unless the response is too small, compressed already, a range, or
+// without a body. Compressed bodies get a Content-Encoding and responses
+// that could have been compressed get Vary: Accept-Encoding.
+func (w *Writer) Compress(c Compression) error {
+	if w.statusWritten() {
+		return errors.New("error: compression must be set before the headers are written")
+	}
+
+	switch c.Encoding {
+	case "", "gzip", "deflate":
+	default:
+		return errors.New("error: unsupported content coding " + c.Encoding)
+	}
+
+	if c.Level < flate.HuffmanOnly || c.Level > flate.BestCompression {
+		return errors.New("error: invalid compression level")
+	}
+
+	w.compression = &compression{Compression: c}
+	return nil
+}
+
+// compressHeaders decides whether the body is compressed once the headers
+// are about to be sent, and updates h to match. length is the length of
+// the body, or -1 if it isn't known.
+func (w *Writer) compressHeaders(h *headers.Headers, length int64) bool {
+	c := w.compression
+	if c == nil || c.decided {
+		return false
+	}
+	c.decided = true
+
+	// Partial content, including multipart/byteranges bodies, is sent as
+	// is since the ranges apply to the uncompressed content.
+	if !w.StatusCode.BodyAllowed() || w.StatusCode == PartialContent || h.Values("Content-Encoding") != nil || h.Values("Content-Range") != nil {
+		return false
+	}
+
+	if !compressible(h.Get("Content-Type")) {
+		return false
+	}
+
+	if !h.HasToken("Vary", "Accept-Encoding") {
+		h.Add("Vary", "Accept-Encoding")
+	}
+
+	if c.Encoding == "" || (length >= 0 && length < int64(c.MinSize)) {
+		return false
+	}
+
+	h.Set("Content-Encoding", c.Encoding)
+	// Ranges would apply to the compressed body.
+	h.Del("Accept-Ranges")
+	// The compressed body is a different representation of the content.
+	etag := h.Get("ETag")
+	if etag != "" && !strings.HasPrefix(etag, "W/") {
+		h.Set("ETag", "W/"+etag)
+	}
+	return true
+}
+
+// newEncoder returns an encoder for c.Encoding. HTTP's deflate coding is
+// the zlib format rather than a raw deflate stream.
+func (c *compression) newEncoder(w io.Writer) (encoder, error) {
+	if c.Encoding == "gzip" {
+		enc, err := gzip.NewWriterLevel(w, c.Level)
+		if err != nil {
+			return nil, err
+		}
+		return enc, nil
+	}
+
+	enc, err := zlib.NewWriterLevel(w, c.Level)
+	if err != nil {
+		return nil, err
+	}
+	return enc, nil
+}
+
+// compressBuffered compresses the buffered body in place, if it is
+// compressed at all, before it is sent with a Content-Length.
+func (w *Writer) compressBuffered(h *headers.Headers) error {
+	if !w.compressHeaders(h, int64(len(w.buf))) {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	enc, err := w.compression.newEncoder(&buf)
+	if err != nil {
+		return err
+	}
+
+	_, err = enc.Write(w.buf)
+	if err != nil {
+		return err
+	}
+
+	err = enc.Close()
+	if err != nil {
+		return err
+	}
+	w.buf = buf.Bytes()
+	return nil
+}
+
+// closeEncoder writes the end of the compressed body.
+func (w *Writer) closeEncoder() error {
+	if w.compression == nil || w.compression.encoder == nil {
+		return nil
+	}
+
+	enc := w.compression.encoder
+	w.compression.encoder = nil
+	return enc.Close()
+}
+
+// bodyEncoder returns the encoder the body is compressed with, or nil.
+func (w *Writer) bodyEncoder() encoder {
+	if w.compression == nil {
+		return nil
+	}
+	return w.compression.encoder
+}
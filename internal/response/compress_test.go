@@ -0,0 +1,195 @@
+package response
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/sambakker4/httpfromtcp/internal/headers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		acceptEncoding string
+		encoding       string
+	}{
+		{"", ""},
+		{"gzip", "gzip"},
+		{"deflate", "deflate"},
+		{"gzip, deflate, br", "gzip"},
+		{"gzip;q=0.5, deflate;q=0.8", "deflate"},
+		{"deflate;q=0.5, gzip;q=0.5", "gzip"},
+		{"gzip;q=0, deflate;q=0", ""},
+		{"*", "gzip"},
+		{"gzip;q=0, *;q=0.3", "deflate"},
+		{"br, identity", ""},
+		{"X-GZIP", "gzip"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.encoding, NegotiateEncoding(tt.acceptEncoding), tt.acceptEncoding)
+	}
+}
+
+func TestCompressFixedLength(t *testing.T) {
+	body := strings.Repeat("compress me please ", 50)
+
+	// Test: A buffered body is compressed and sent with its new length
+	buf := &bytes.Buffer{}
+	w := &Writer{Writer: buf}
+	require.NoError(t, w.Compress(Compression{Encoding: "gzip", Level: flate.DefaultCompression, MinSize: 100}))
+	w.Headers().Set("Content-Type", "text/html")
+	w.Write([]byte(body))
+	require.NoError(t, w.Finish())
+
+	resp, raw := readResponse(t, buf)
+	assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", resp.Header.Get("Vary"))
+	assert.Equal(t, int64(len(raw)), resp.ContentLength)
+	assert.Less(t, len(raw), len(body))
+
+	gz, err := gzip.NewReader(strings.NewReader(raw))
+	require.NoError(t, err)
+	decoded, err := io.ReadAll(gz)
+	require.NoError(t, err)
+	assert.Equal(t, body, string(decoded))
+
+	// Test: Tiny bodies are sent as is
+	buf = &bytes.Buffer{}
+	w = &Writer{Writer: buf}
+	require.NoError(t, w.Compress(Compression{Encoding: "gzip", Level: flate.DefaultCompression, MinSize: 100}))
+	w.Write([]byte("tiny"))
+	require.NoError(t, w.Finish())
+	resp, raw = readResponse(t, buf)
+	assert.Empty(t, resp.Header.Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", resp.Header.Get("Vary"))
+	assert.Equal(t, "tiny", raw)
+
+	// Test: Compressed content types are sent as is
+	buf = &bytes.Buffer{}
+	w = &Writer{Writer: buf}
+	require.NoError(t, w.Compress(Compression{Encoding: "gzip", Level: flate.DefaultCompression}))
+	w.Headers().Set("Content-Type", "video/mp4")
+	w.Write([]byte(body))
+	require.NoError(t, w.Finish())
+	resp, raw = readResponse(t, buf)
+	assert.Empty(t, resp.Header.Get("Content-Encoding"))
+	assert.Empty(t, resp.Header.Get("Vary"))
+	assert.Equal(t, body, raw)
+
+	// Test: Invalid settings
+	w = &Writer{Writer: &bytes.Buffer{}}
+	require.Error(t, w.Compress(Compression{Encoding: "br"}))
+	require.Error(t, w.Compress(Compression{Encoding: "gzip", Level: 42}))
+}
+
+func TestCompressChunked(t *testing.T) {
+	body := strings.Repeat("a long streamed body ", 1000)
+
+	// Test: A body too large to buffer is compressed and chunked
+	buf := &bytes.Buffer{}
+	w := &Writer{Writer: buf}
+	require.NoError(t, w.Compress(Compression{Encoding: "deflate", Level: flate.BestSpeed, MinSize: 100}))
+	w.Headers().Set("ETag", `"v1"`)
+	for i := 0; i < len(body); i += 1000 {
+		w.Write([]byte(body[i:min(i+1000, len(body))]))
+	}
+	require.NoError(t, w.Finish())
+
+	resp, raw := readResponse(t, buf)
+	assert.Equal(t, []string{"chunked"}, resp.TransferEncoding)
+	assert.Equal(t, "deflate", resp.Header.Get("Content-Encoding"))
+	assert.Equal(t, `W/"v1"`, resp.Header.Get("ETag"))
+
+	zr, err := zlib.NewReader(strings.NewReader(raw))
+	require.NoError(t, err)
+	decoded, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	assert.Equal(t, body, string(decoded))
+
+	// Test: An explicit Content-Length is replaced by chunked framing
+	buf = &bytes.Buffer{}
+	w = &Writer{Writer: buf}
+	require.NoError(t, w.Compress(Compression{Encoding: "gzip", Level: flate.DefaultCompression, MinSize: 100}))
+	h := GetDefaultHeaders(len(body))
+	h.Set("Accept-Ranges", "bytes")
+	require.NoError(t, w.WriteStatusLine(Success))
+	require.NoError(t, w.WriteHeaders(h))
+	_, err = w.WriteBody([]byte(body))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+
+	resp, raw = readResponse(t, buf)
+	assert.Equal(t, []string{"chunked"}, resp.TransferEncoding)
+	assert.Empty(t, resp.Header.Get("Accept-Ranges"))
+	gz, err := gzip.NewReader(strings.NewReader(raw))
+	require.NoError(t, err)
+	decoded, err = io.ReadAll(gz)
+	require.NoError(t, err)
+	assert.Equal(t, body, string(decoded))
+
+	// Test: Trailers follow the compressed body
+	buf = &bytes.Buffer{}
+	w = &Writer{Writer: buf}
+	require.NoError(t, w.Compress(Compression{Encoding: "gzip", Level: flate.DefaultCompression}))
+	require.NoError(t, w.DeclareTrailer("X-Checksum"))
+	w.Write([]byte(body))
+	w.SetTrailer("X-Checksum", "abc")
+	require.NoError(t, w.Finish())
+
+	resp, raw = readResponse(t, buf)
+	assert.Equal(t, "abc", resp.Trailer.Get("X-Checksum"))
+	gz, err = gzip.NewReader(strings.NewReader(raw))
+	require.NoError(t, err)
+	decoded, err = io.ReadAll(gz)
+	require.NoError(t, err)
+	assert.Equal(t, body, string(decoded))
+
+	// Test: HTTP/1.0 gets a compressed body delimited by closing the
+	// connection
+	buf = &bytes.Buffer{}
+	w = &Writer{Writer: buf, HttpVersion: "1.0"}
+	require.NoError(t, w.Compress(Compression{Encoding: "gzip", Level: flate.DefaultCompression}))
+	w.Write([]byte(body))
+	require.NoError(t, w.Finish())
+	assert.True(t, w.CloseConnection)
+
+	resp, raw = readResponse(t, buf)
+	assert.Nil(t, resp.TransferEncoding)
+	assert.Equal(t, int64(-1), resp.ContentLength)
+	gz, err = gzip.NewReader(strings.NewReader(raw))
+	require.NoError(t, err)
+	decoded, err = io.ReadAll(gz)
+	require.NoError(t, err)
+	assert.Equal(t, body, string(decoded))
+
+	// Test: Ranges are sent as is
+	buf = &bytes.Buffer{}
+	w = &Writer{Writer: buf}
+	require.NoError(t, w.Compress(Compression{Encoding: "gzip", Level: flate.DefaultCompression}))
+	h = headers.NewHeaders()
+	h.Set("Content-Range", "bytes 0-4/10")
+	h.Set("Content-Length", "5")
+	require.NoError(t, w.WriteStatusLine(PartialContent))
+	require.NoError(t, w.WriteHeaders(h))
+	w.WriteBody([]byte("hello"))
+	require.NoError(t, w.Finish())
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\nhello"))
+
+	// Test: Multipart ranges are sent as is
+	buf = &bytes.Buffer{}
+	w = &Writer{Writer: buf}
+	require.NoError(t, w.Compress(Compression{Encoding: "gzip", Level: flate.DefaultCompression}))
+	w.Headers().Set("Content-Type", "multipart/byteranges; boundary=b")
+	w.SetStatus(PartialContent)
+	w.Write([]byte(body))
+	require.NoError(t, w.Finish())
+	resp, raw = readResponse(t, buf)
+	assert.Empty(t, resp.Header.Get("Content-Encoding"))
+	assert.Equal(t, body, raw)
+}
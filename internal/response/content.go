@@ -0,0 +1,412 @@
+package response
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sambakker4/httpfromtcp/internal/request"
+)
+
+const (
+	// sniffLen is how much of the content is used to detect its type.
+	sniffLen = 512
+	// maxRanges is the most ranges served from one request. Requests for
+	// more get the whole content.
+	maxRanges = 16
+)
+
+// contentTypes covers common extensions that the system's MIME tables
+// may not know.
+var contentTypes = map[string]string{
+	".md":    "text/markdown; charset=utf-8",
+	".mp3":   "audio/mpeg",
+	".mp4":   "video/mp4",
+	".ogg":   "audio/ogg",
+	".txt":   "text/plain; charset=utf-8",
+	".wav":   "audio/wav",
+	".webm":  "video/webm",
+	".woff2": "font/woff2",
+}
+
+// httpDate is the format of dates in headers such as Last-Modified.
+const httpDate = "Mon, 02 Jan 2006 15:04:05 GMT"
+
+// byteRange is the part of the content from start to start+length.
+type byteRange struct {
+	start  int64
+	length int64
+}
+
+func (r byteRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.start, r.start+r.length-1, size)
+}
+
+var errNoOverlap = errors.New("error: no range overlaps the content")
+
+// parseRange parses a Range header for content of size bytes. It returns
+// nil ranges when the header should be ignored, and errNoOverlap when no
+// range can be satisfied.
+func parseRange(header string, size int64) ([]byteRange, error) {
+	unit, specs, found := strings.Cut(header, "=")
+	if !found || strings.TrimSpace(unit) != "bytes" {
+		return nil, nil
+	}
+
+	var ranges []byteRange
+	for _, spec := range strings.Split(specs, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+
+		first, last, found := strings.Cut(spec, "-")
+		if !found {
+			return nil, nil
+		}
+
+		var r byteRange
+		if first == "" {
+			// A suffix range: the last bytes of the content.
+			n, err := strconv.ParseInt(last, 10, 64)
+			if err != nil || n < 0 {
+				return nil, nil
+			}
+			// Empty content has no last bytes to send.
+			if n == 0 || size == 0 {
+				continue
+			}
+			r.start = max(size-n, 0)
+			r.length = size - r.start
+		} else {
+			start, err := strconv.ParseInt(first, 10, 64)
+			if err != nil || start < 0 {
+				return nil, nil
+			}
+
+			end := size - 1
+			if last != "" {
+				end, err = strconv.ParseInt(last, 10, 64)
+				if err != nil || end < start {
+					return nil, nil
+				}
+			}
+
+			if start >= size {
+				continue
+			}
+			r.start = start
+			r.length = min(end, size-1) - start + 1
+		}
+		ranges = append(ranges, r)
+	}
+
+	if ranges == nil {
+		return nil, errNoOverlap
+	}
+	return ranges, nil
+}
+
+// ServeContent answers req with content, streaming it and serving the
+// byte ranges the request asks for. The Content-Type is taken from the
+// response headers, the extension of name or the content itself. A
+// non-zero modtime is sent as Last-Modified and, like an ETag set in the
+// response headers, is used for conditional requests and If-Range.
+func ServeContent(w *Writer, req *request.Request, name string, modtime time.Time, content io.ReadSeeker) {
+	size, err := content.Seek(0, io.SeekEnd)
+	if err != nil {
+		serveError(w, InternalServerError)
+		return
+	}
+
+	h := w.Headers()
+	if !modtime.IsZero() && !modtime.Equal(time.Unix(0, 0)) {
+		h.Set("Last-Modified", modtime.UTC().Format(httpDate))
+	}
+
+	if checkPreconditions(w, req, modtime) {
+		return
+	}
+
+	if h.Get("Content-Type") == "" {
+		contentType, err := detectContentType(name, content)
+		if err != nil {
+			serveError(w, InternalServerError)
+			return
+		}
+		h.Set("Content-Type", contentType)
+	}
+
+	h.Set("Accept-Ranges", "bytes")
+
+	var ranges []byteRange
+	rangeHeader := req.Headers.Get("Range")
+	if rangeHeader != "" && checkIfRange(req, h.Get("ETag"), modtime) {
+		ranges, err = parseRange(rangeHeader, size)
+		if errors.Is(err, errNoOverlap) {
+			h.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+			serveError(w, RangeNotSatisfiable)
+			return
+		}
+		if len(ranges) > maxRanges {
+			ranges = nil
+		}
+	}
+
+	switch len(ranges) {
+	case 0:
+		h.Set("Content-Length", strconv.FormatInt(size, 10))
+		copyRange(w, content, byteRange{start: 0, length: size})
+	case 1:
+		h.Set("Content-Range", ranges[0].contentRange(size))
+		h.Set("Content-Length", strconv.FormatInt(ranges[0].length, 10))
+		w.SetStatus(PartialContent)
+		copyRange(w, content, ranges[0])
+	default:
+		serveMultipart(w, content, ranges, size)
+	}
+}
+
+// ServeFile answers req with the file at path, as ServeContent does.
+func ServeFile(w *Writer, req *request.Request, path string) {
+	f, err := os.Open(path)
+	if err != nil {
+		serveError(w, errorStatus(err))
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		serveError(w, errorStatus(err))
+		return
+	}
+
+	if info.IsDir() {
+		serveError(w, NotFound)
+		return
+	}
+	ServeContent(w, req, info.Name(), info.ModTime(), f)
+}
+
+// errorStatus returns the status code for an error opening a file.
+func errorStatus(err error) StatusCode {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return NotFound
+	case errors.Is(err, fs.ErrPermission):
+		return Forbidden
+	default:
+		return InternalServerError
+	}
+}
+
+func serveError(w *Writer, statusCode StatusCode) {
+	h := w.Headers()
+	h.Del("Content-Length")
+	h.Set("Content-Type", "text/plain")
+	w.SetStatus(statusCode)
+	w.Write([]byte(StatusText(statusCode) + "\n"))
+}
+
+// detectContentType finds the type of content from the extension of name,
+// falling back to sniffing its first bytes.
+func detectContentType(name string, content io.ReadSeeker) (string, error) {
+	ext := strings.ToLower(filepath.Ext(name))
+	contentType, ok := contentTypes[ext]
+	if ok {
+		return contentType, nil
+	}
+
+	contentType = mime.TypeByExtension(ext)
+	if contentType != "" {
+		return contentType, nil
+	}
+
+	_, err := content.Seek(0, io.SeekStart)
+	if err != nil {
+		return "", err
+	}
+
+	buf := make([]byte, sniffLen)
+	n, err := io.ReadFull(content, buf)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", err
+	}
+	return sniffContentType(buf[:n]), nil
+}
+
+// checkPreconditions evaluates the conditional headers of req against the
+// response's ETag and modtime. It reports whether it answered the request
+// with 304 Not Modified or 412 Precondition Failed.
+func checkPreconditions(w *Writer, req *request.Request, modtime time.Time) bool {
+	etag := w.Headers().Get("ETag")
+	hasModtime := !modtime.IsZero() && !modtime.Equal(time.Unix(0, 0))
+	readOnly := req.RequestLine.Method == "GET" || req.RequestLine.Method == "HEAD"
+
+	if ifMatch := req.Headers.Get("If-Match"); ifMatch != "" {
+		if !etagMatches(ifMatch, etag, false) {
+			serveError(w, PreconditionFailed)
+			return true
+		}
+	} else if t, ok := parseDate(req.Headers.Get("If-Unmodified-Since")); ok && hasModtime {
+		if modtime.Truncate(time.Second).After(t) {
+			serveError(w, PreconditionFailed)
+			return true
+		}
+	}
+
+	notModified := false
+	if ifNoneMatch := req.Headers.Get("If-None-Match"); ifNoneMatch != "" {
+		if etagMatches(ifNoneMatch, etag, true) {
+			if !readOnly {
+				serveError(w, PreconditionFailed)
+				return true
+			}
+			notModified = true
+		}
+	} else if t, ok := parseDate(req.Headers.Get("If-Modified-Since")); ok && hasModtime && readOnly {
+		notModified = !modtime.Truncate(time.Second).After(t)
+	}
+
+	if !notModified {
+		return false
+	}
+
+	h := w.Headers()
+	h.Del("Content-Type")
+	h.Del("Content-Length")
+	w.SetStatus(NotModified)
+	return true
+}
+
+// etagMatches reports whether etag is in list, a comma-separated list of
+// entity tags or "*". Weak comparison ignores the W/ prefix.
+func etagMatches(list string, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(list, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+
+		if etag == "" {
+			continue
+		}
+
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+			if candidate == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		} else if candidate == etag && !strings.HasPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+func parseDate(value string) (time.Time, bool) {
+	if value == "" {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(httpDate, value)
+	return t, err == nil
+}
+
+// checkIfRange reports whether the Range header should be honored: when
+// there's no If-Range, or it still matches the content's ETag or
+// modification time.
+func checkIfRange(req *request.Request, etag string, modtime time.Time) bool {
+	ifRange := req.Headers.Get("If-Range")
+	if ifRange == "" {
+		return true
+	}
+
+	if strings.HasPrefix(ifRange, `"`) {
+		return etag != "" && ifRange == etag
+	}
+
+	t, err := time.Parse(httpDate, ifRange)
+	if err != nil || modtime.IsZero() {
+		return false
+	}
+	return modtime.Truncate(time.Second).Equal(t)
+}
+
+// copyRange writes one range of content to w. HEAD responses skip reading
+// the content.
+func copyRange(w *Writer, content io.ReadSeeker, r byteRange) error {
+	if w.OmitBody {
+		return nil
+	}
+
+	_, err := content.Seek(r.start, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.CopyN(w, content, r.length)
+	return err
+}
+
+// serveMultipart sends several ranges as a multipart/byteranges body.
+func serveMultipart(w *Writer, content io.ReadSeeker, ranges []byteRange, size int64) {
+	boundary, err := newBoundary()
+	if err != nil {
+		serveError(w, InternalServerError)
+		return
+	}
+
+	h := w.Headers()
+	contentType := h.Get("Content-Type")
+	partHeader := func(r byteRange) string {
+		return "--" + boundary + "\r\n" +
+			"Content-Type: " + contentType + "\r\n" +
+			"Content-Range: " + r.contentRange(size) + "\r\n" +
+			"\r\n"
+	}
+	closing := "\r\n--" + boundary + "--\r\n"
+
+	var length int64
+	for i, r := range ranges {
+		if i > 0 {
+			length += int64(len("\r\n"))
+		}
+		length += int64(len(partHeader(r))) + r.length
+	}
+	length += int64(len(closing))
+
+	h.Set("Content-Type", "multipart/byteranges; boundary="+boundary)
+	h.Set("Content-Length", strconv.FormatInt(length, 10))
+	w.SetStatus(PartialContent)
+
+	for i, r := range ranges {
+		if i > 0 {
+			w.Write([]byte("\r\n"))
+		}
+		w.Write([]byte(partHeader(r)))
+		err := copyRange(w, content, r)
+		if err != nil {
+			return
+		}
+	}
+	w.Write([]byte(closing))
+}
+
+func newBoundary() (string, error) {
+	buf := make([]byte, 16)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
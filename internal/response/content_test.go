@@ -0,0 +1,189 @@
+package response
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sambakker4/httpfromtcp/internal/headers"
+	"github.com/sambakker4/httpfromtcp/internal/request"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serveContent(t *testing.T, hdrs map[string]string, name string, modtime time.Time, content string) (*http.Response, string) {
+	t.Helper()
+	req := &request.Request{Headers: headers.NewHeaders()}
+	for key, val := range hdrs {
+		req.Headers.Set(key, val)
+	}
+
+	buf := &bytes.Buffer{}
+	w := &Writer{Writer: buf}
+	ServeContent(w, req, name, modtime, strings.NewReader(content))
+	require.NoError(t, w.Finish())
+	return readResponse(t, buf)
+}
+
+func TestServeContent(t *testing.T) {
+	content := "0123456789abcdefghij"
+	modtime := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+
+	// Test: The whole content, typed by its extension
+	resp, body := serveContent(t, nil, "notes.txt", modtime, content)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, content, body)
+	assert.Equal(t, int64(20), resp.ContentLength)
+	assert.Equal(t, "text/plain; charset=utf-8", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "bytes", resp.Header.Get("Accept-Ranges"))
+	assert.Equal(t, "Sun, 18 Oct 2026 12:00:00 GMT", resp.Header.Get("Last-Modified"))
+
+	// Test: Content-Type sniffed from the content
+	resp, _ = serveContent(t, nil, "page", time.Time{}, "<html><body>hi</body></html>")
+	assert.Equal(t, "text/html; charset=utf-8", resp.Header.Get("Content-Type"))
+	assert.Empty(t, resp.Header.Get("Last-Modified"))
+
+	// Test: A single range
+	resp, body = serveContent(t, map[string]string{"Range": "bytes=2-5"}, "notes.txt", modtime, content)
+	assert.Equal(t, http.StatusPartialContent, resp.StatusCode)
+	assert.Equal(t, "2345", body)
+	assert.Equal(t, "bytes 2-5/20", resp.Header.Get("Content-Range"))
+
+	// Test: Suffix and open ended ranges
+	_, body = serveContent(t, map[string]string{"Range": "bytes=-3"}, "notes.txt", modtime, content)
+	assert.Equal(t, "hij", body)
+	_, body = serveContent(t, map[string]string{"Range": "bytes=15-100"}, "notes.txt", modtime, content)
+	assert.Equal(t, "fghij", body)
+
+	// Test: Unsatisfiable range
+	resp, _ = serveContent(t, map[string]string{"Range": "bytes=20-"}, "notes.txt", modtime, content)
+	assert.Equal(t, http.StatusRequestedRangeNotSatisfiable, resp.StatusCode)
+	assert.Equal(t, "bytes */20", resp.Header.Get("Content-Range"))
+
+	// Test: Suffix ranges of empty content are unsatisfiable
+	resp, _ = serveContent(t, map[string]string{"Range": "bytes=-5"}, "empty.txt", modtime, "")
+	assert.Equal(t, http.StatusRequestedRangeNotSatisfiable, resp.StatusCode)
+	assert.Equal(t, "bytes */0", resp.Header.Get("Content-Range"))
+
+	// Test: Malformed ranges are ignored
+	resp, body = serveContent(t, map[string]string{"Range": "bytes=5-2"}, "notes.txt", modtime, content)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, content, body)
+
+	// Test: If-Range with a stale date serves the whole content
+	resp, _ = serveContent(t, map[string]string{"Range": "bytes=2-5", "If-Range": "Sat, 17 Oct 2026 12:00:00 GMT"}, "notes.txt", modtime, content)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Test: If-Range with the current date serves the range
+	resp, _ = serveContent(t, map[string]string{"Range": "bytes=2-5", "If-Range": "Sun, 18 Oct 2026 12:00:00 GMT"}, "notes.txt", modtime, content)
+	assert.Equal(t, http.StatusPartialContent, resp.StatusCode)
+}
+
+func TestServeContentPreconditions(t *testing.T) {
+	modtime := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	serve := func(hdrs map[string]string) *http.Response {
+		req := &request.Request{RequestLine: request.RequestLine{Method: "GET"}, Headers: headers.NewHeaders()}
+		for key, val := range hdrs {
+			req.Headers.Set(key, val)
+		}
+
+		buf := &bytes.Buffer{}
+		w := &Writer{Writer: buf}
+		w.Headers().Set("ETag", `"v1"`)
+		ServeContent(w, req, "notes.txt", modtime, strings.NewReader("content"))
+		require.NoError(t, w.Finish())
+		resp, _ := readResponse(t, buf)
+		return resp
+	}
+
+	// Test: If-None-Match with the current ETag
+	resp := serve(map[string]string{"If-None-Match": `"v0", W/"v1"`})
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+	assert.Equal(t, `"v1"`, resp.Header.Get("ETag"))
+	assert.Empty(t, resp.Header.Get("Content-Type"))
+
+	// Test: If-None-Match takes precedence over If-Modified-Since
+	resp = serve(map[string]string{"If-None-Match": `"v0"`, "If-Modified-Since": "Sun, 18 Oct 2026 12:00:00 GMT"})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Test: If-Match and If-Unmodified-Since
+	resp = serve(map[string]string{"If-Match": `"v0"`})
+	assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+	resp = serve(map[string]string{"If-Match": "*"})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = serve(map[string]string{"If-Unmodified-Since": "Sat, 17 Oct 2026 12:00:00 GMT"})
+	assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+}
+
+func TestServeContentMultipleRanges(t *testing.T) {
+	content := "0123456789abcdefghij"
+
+	// Test: Several ranges as multipart/byteranges
+	resp, body := serveContent(t, map[string]string{"Range": "bytes=0-1, 10-12, -2"}, "notes.txt", time.Time{}, content)
+	assert.Equal(t, http.StatusPartialContent, resp.StatusCode)
+	assert.Equal(t, int64(len(body)), resp.ContentLength)
+
+	mediaType, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	assert.Equal(t, "multipart/byteranges", mediaType)
+
+	reader := multipart.NewReader(strings.NewReader(body), params["boundary"])
+	expected := []struct{ contentRange, data string }{
+		{"bytes 0-1/20", "01"},
+		{"bytes 10-12/20", "abc"},
+		{"bytes 18-19/20", "ij"},
+	}
+	for _, part := range expected {
+		p, err := reader.NextPart()
+		require.NoError(t, err)
+		assert.Equal(t, part.contentRange, p.Header.Get("Content-Range"))
+		assert.Equal(t, "text/plain; charset=utf-8", p.Header.Get("Content-Type"))
+		data, err := io.ReadAll(p)
+		require.NoError(t, err)
+		assert.Equal(t, part.data, string(data))
+	}
+	_, err = reader.NextPart()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestServeFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "clip.mp4")
+	require.NoError(t, os.WriteFile(path, []byte("not really a video"), 0o644))
+	req := &request.Request{Headers: headers.NewHeaders()}
+
+	// Test: A file is served with its type and size
+	buf := &bytes.Buffer{}
+	w := &Writer{Writer: buf}
+	ServeFile(w, req, path)
+	require.NoError(t, w.Finish())
+	resp, body := readResponse(t, buf)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "video/mp4", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "not really a video", body)
+
+	// Test: HEAD gets the headers without reading the file
+	buf = &bytes.Buffer{}
+	w = &Writer{Writer: buf, OmitBody: true}
+	ServeFile(w, req, path)
+	require.NoError(t, w.Finish())
+	assert.Contains(t, buf.String(), "Content-Length: 18\r\n")
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\n"))
+
+	// Test: Missing files and directories are 404s
+	for _, missing := range []string{filepath.Join(dir, "missing.mp4"), dir} {
+		buf = &bytes.Buffer{}
+		w = &Writer{Writer: buf}
+		ServeFile(w, req, missing)
+		require.NoError(t, w.Finish())
+		resp, _ = readResponse(t, buf)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	}
+}
@@ -0,0 +1,230 @@
+package response
+
+import (
+	"errors"
+	"strconv"
+)
+
+// maxBufferedBody is how much of a body is buffered while the headers
+// haven't been sent, so the Content-Length can be computed. Longer bodies
+// are sent chunked.
+const maxBufferedBody = 4 << 10
+
+// SetStatus sets the status code sent with the headers by Write, Flush or
+// Finish. Responses without one are sent as 200 OK.
+func (w *Writer) SetStatus(statusCode StatusCode) error {
+	if w.statusWritten() {
+		return errors.New("error: headers were already written")
+	}
+
+	if !statusCode.Valid() || statusCode.Informational() {
+		return errors.New("error: invalid status code for a final response")
+	}
+
+	w.StatusCode = statusCode
+	return nil
+}
+
+// Status returns the status code the response is sent with. Until one is
+// set or written, that is the 200 OK a response gets by default.
+func (w *Writer) Status() StatusCode {
+	return w.finalStatus()
+}
+
+// finalStatus returns the status code to send the headers with.
+func (w *Writer) finalStatus() StatusCode {
+	if w.StatusCode == 0 || w.StatusCode.Informational() {
+		return Success
+	}
+	return w.StatusCode
+}
+
+// Write writes p to the response body, so handlers don't have to frame
+// the body themselves. Before the headers are sent, the body is buffered
+// until it outgrows the buffer, when the headers are sent with chunked
+// encoding. A Content-Length or Transfer-Encoding set in Headers sends the
+// headers right away instead.
+func (w *Writer) Write(p []byte) (int, error) {
+	if !w.statusWritten() {
+		w.StatusCode = w.finalStatus()
+		if len(p) > 0 && !w.StatusCode.BodyAllowed() {
+			return 0, errors.New("error: status code does not allow a body")
+		}
+
+		h := w.Headers()
+		framed := h.Values("Content-Length") != nil || h.Values("Transfer-Encoding") != nil || w.sendsTrailers()
+		if !framed && len(w.buf)+len(p) <= maxBufferedBody {
+			w.buf = append(w.buf, p...)
+			w.bytesWritten += int64(len(p))
+			return len(p), nil
+		}
+
+		err := w.Flush()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if w.state != writerStateBody {
+		return 0, errors.New("error: writing request in the wrong order")
+	}
+
+	if w.chunks != nil {
+		return w.WriteChunkedBody(p)
+	}
+	return w.WriteBody(p)
+}
+
+// Flush sends the headers if they haven't been sent, followed by the
+// buffered body. Without a Content-Length the body continues chunked, or
+// until the connection is closed for HTTP/1.0.
+func (w *Writer) Flush() error {
+	if !w.statusWritten() {
+		w.StatusCode = w.finalStatus()
+		h := w.Headers()
+		if w.StatusCode.BodyAllowed() && h.Values("Content-Length") == nil && h.Values("Transfer-Encoding") == nil {
+			h.Set("Transfer-Encoding", "chunked")
+		}
+
+		err := w.sendHeaders()
+		if err != nil {
+			return err
+		}
+	}
+
+	// Compressed data waits in the encoder until it is flushed.
+	if enc := w.bodyEncoder(); enc != nil {
+		return enc.Flush()
+	}
+	return nil
+}
+
+// Finish completes the response once the handler has returned. Headers
+// that haven't been sent are sent with the buffered body's length, a
+// chunked body gets its last chunk, and a body shorter than its
+// Content-Length is an error, after which the connection must be closed.
+// A handler that wrote nothing at all gets an empty 200 OK, so the client
+// isn't left waiting.
+func (w *Writer) Finish() error {
+	if !w.statusWritten() {
+		// Trailers need a chunked body, otherwise the whole body is
+		// buffered and its length is known.
+		var err error
+		if w.sendsTrailers() {
+			err = w.Flush()
+		} else {
+			w.StatusCode = w.finalStatus()
+			h := w.Headers()
+			if w.StatusCode.BodyAllowed() && h.Values("Content-Length") == nil && h.Values("Transfer-Encoding") == nil {
+				err = w.compressBuffered(h)
+				if err != nil {
+					return err
+				}
+				h.Set("Content-Length", strconv.Itoa(len(w.buf)))
+			}
+			err = w.sendHeaders()
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if w.state != writerStateBody {
+		return errors.New("error: response headers were not written")
+	}
+
+	if w.chunks != nil && w.trailers != nil && w.chunks.Trailers == nil {
+		err := w.checkTrailers(w.trailers)
+		if err != nil {
+			return err
+		}
+		w.chunks.Trailers = w.trailers
+	}
+
+	err := w.closeEncoder()
+	if err != nil {
+		return err
+	}
+
+	if w.chunks != nil {
+		err := w.chunks.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	if w.contentLength > w.bytesWritten && !w.OmitBody && w.StatusCode.BodyAllowed() {
+		w.CloseConnection = true
+		return errors.New("error: body is shorter than its Content-Length")
+	}
+	return nil
+}
+
+// Discard drops the response the handler left pending, so another one can
+// be written in its place. It fails once the response has started.
+func (w *Writer) Discard() error {
+	if w.Started() {
+		return errors.New("error: headers were already written")
+	}
+	w.reset()
+	return nil
+}
+
+// reset forgets everything about the response that hasn't been sent: the
+// status, headers, buffered body, declared trailers and whether the body
+// is compressed.
+func (w *Writer) reset() {
+	w.state = writerStateStatusLine
+	w.StatusCode = 0
+	w.statusLine = nil
+	w.headers = nil
+	w.buf = nil
+	w.bytesWritten = 0
+	w.trailerNames = nil
+	w.trailers = nil
+	if w.compression != nil {
+		w.compression.decided = false
+		w.compression.encoder = nil
+	}
+}
+
+// sendHeaders writes the status line and headers, then the buffered body.
+func (w *Writer) sendHeaders() error {
+	buf := w.buf
+	w.buf = nil
+	w.bytesWritten = 0
+
+	// Check the headers first, so a bad one still leaves room for an
+	// error response.
+	h := w.Headers()
+	err := h.Validate()
+	if err != nil {
+		return err
+	}
+
+	_, err = parseContentLength(h)
+	if err != nil {
+		return err
+	}
+
+	err = w.addTrailerHeader(h)
+	if err != nil {
+		return err
+	}
+
+	err = w.WriteStatusLine(w.StatusCode)
+	if err != nil {
+		return err
+	}
+
+	err = w.WriteHeaders(h)
+	if err != nil {
+		return err
+	}
+
+	if len(buf) == 0 {
+		return nil
+	}
+	_, err = w.Write(buf)
+	return err
+}
@@ -0,0 +1,220 @@
+package response
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/sambakker4/httpfromtcp/internal/headers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readResponse(t *testing.T, buf *bytes.Buffer) (*http.Response, string) {
+	t.Helper()
+	resp, err := http.ReadResponse(bufio.NewReader(buf), nil)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp, string(body)
+}
+
+func TestFramingContentLength(t *testing.T) {
+	// Test: A small body is buffered and sent with its length
+	buf := &bytes.Buffer{}
+	w := &Writer{Writer: buf}
+	w.Headers().Set("Content-Type", "text/html")
+	_, err := w.Write([]byte("<h1>"))
+	require.NoError(t, err)
+	_, err = w.Write([]byte("hi</h1>"))
+	require.NoError(t, err)
+	assert.Equal(t, 0, buf.Len())
+	assert.Equal(t, int64(11), w.BytesWritten())
+
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Content-Type: text/html\r\n"+
+		"Content-Length: 11\r\n"+
+		"\r\n"+
+		"<h1>hi</h1>", buf.String())
+	assert.False(t, w.CloseConnection)
+
+	// Test: A status without a body
+	buf = &bytes.Buffer{}
+	w = &Writer{Writer: buf}
+	require.NoError(t, w.SetStatus(NoContent))
+	require.Error(t, w.SetStatus(Continue))
+	_, err = w.Write([]byte("body"))
+	require.Error(t, err)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 204 No Content\r\n\r\n", buf.String())
+
+	// Test: HEAD responses get the length without the body
+	buf = &bytes.Buffer{}
+	w = &Writer{Writer: buf, OmitBody: true}
+	w.Write([]byte("hello"))
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\n", buf.String())
+
+	// Test: A handler that wrote nothing gets an empty 200
+	buf = &bytes.Buffer{}
+	w = &Writer{Writer: buf}
+	require.NoError(t, w.Finish())
+	assert.True(t, w.Started())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n", buf.String())
+}
+
+func TestFramingChunked(t *testing.T) {
+	// Test: A body larger than the buffer switches to chunked
+	body := strings.Repeat("abcdefgh", maxBufferedBody/4)
+	buf := &bytes.Buffer{}
+	w := &Writer{Writer: buf}
+	require.NoError(t, w.SetStatus(Created))
+	for i := 0; i < len(body); i += 1000 {
+		_, err := w.Write([]byte(body[i:min(i+1000, len(body))]))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Finish())
+
+	resp, got := readResponse(t, buf)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, []string{"chunked"}, resp.TransferEncoding)
+	assert.Equal(t, body, got)
+	assert.Equal(t, int64(len(body)), w.BytesWritten())
+
+	// Test: Flush sends the headers and continues chunked
+	buf = &bytes.Buffer{}
+	w = &Writer{Writer: buf}
+	w.Write([]byte("first "))
+	require.NoError(t, w.Flush())
+	assert.True(t, w.Started())
+	assert.True(t, strings.HasSuffix(buf.String(), "6\r\nfirst \r\n"))
+	w.Write([]byte("second"))
+	require.NoError(t, w.Finish())
+
+	resp, got = readResponse(t, buf)
+	assert.Equal(t, []string{"chunked"}, resp.TransferEncoding)
+	assert.Equal(t, "first second", got)
+}
+
+func TestFramingExplicitContentLength(t *testing.T) {
+	// Test: A Content-Length set by the handler sends the headers right away
+	buf := &bytes.Buffer{}
+	w := &Writer{Writer: buf}
+	w.Headers().Set("Content-Length", "5")
+	_, err := w.Write([]byte("hel"))
+	require.NoError(t, err)
+	assert.True(t, w.Started())
+
+	// Test: Writing past the Content-Length is an error
+	_, err = w.Write([]byte("lo!"))
+	require.Error(t, err)
+
+	// Test: Stopping short of it is an error too
+	require.Error(t, w.Finish())
+	assert.True(t, w.CloseConnection)
+
+	// Test: An invalid Content-Length is rejected before anything is sent
+	buf = &bytes.Buffer{}
+	w = &Writer{Writer: buf}
+	w.Headers().Set("Content-Length", "five")
+	_, err = w.Write([]byte("hello"))
+	require.Error(t, err)
+	assert.False(t, w.Started())
+	assert.Equal(t, 0, buf.Len())
+
+	// Test: A buffered body isn't thrown away by an explicit status line
+	buf = &bytes.Buffer{}
+	w = &Writer{Writer: buf}
+	w.Write([]byte("hello"))
+	require.Error(t, w.WriteStatusLine(Created))
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nhello", buf.String())
+}
+
+func TestFramingHTTP10(t *testing.T) {
+	// Test: A small body is sent with its length, keeping the connection
+	buf := &bytes.Buffer{}
+	w := &Writer{Writer: buf, HttpVersion: "1.0"}
+	w.Write([]byte("hello"))
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.0 200 OK\r\n"+
+		"Content-Length: 5\r\n"+
+		"Connection: keep-alive\r\n"+
+		"\r\n"+
+		"hello", buf.String())
+	assert.False(t, w.CloseConnection)
+
+	// Test: A long body ends when the connection is closed
+	body := strings.Repeat("x", maxBufferedBody+1)
+	buf = &bytes.Buffer{}
+	w = &Writer{Writer: buf, HttpVersion: "1.0"}
+	w.Write([]byte(body))
+	require.NoError(t, w.Finish())
+	assert.True(t, w.CloseConnection)
+	resp, raw := readResponse(t, buf)
+	assert.Equal(t, "HTTP/1.0", resp.Proto)
+	assert.Nil(t, resp.TransferEncoding)
+	assert.Equal(t, "close", resp.Header.Get("Connection"))
+	assert.Equal(t, body, raw)
+
+	// Test: The explicit chunked API sends the data as is
+	buf = &bytes.Buffer{}
+	w = &Writer{Writer: buf, HttpVersion: "1.0"}
+	require.NoError(t, w.DeclareTrailer("X-Checksum"))
+	h := GetDefaultHeaders(0)
+	h.Del("Content-Length")
+	h.Set("Transfer-Encoding", "chunked")
+	h.Set("Trailer", "X-Checksum")
+	require.NoError(t, w.WriteStatusLine(Success))
+	require.NoError(t, w.WriteHeaders(h))
+	_, err := w.WriteChunkedBody([]byte("hello "))
+	require.NoError(t, err)
+	_, err = w.WriteChunkedBody([]byte("world"))
+	require.NoError(t, err)
+	trailers := headers.NewHeaders()
+	trailers.Set("X-Checksum", "abc")
+	require.NoError(t, w.WriteTrailers(trailers))
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.0 200 OK\r\n"+
+		"Content-Type: text/plain\r\n"+
+		"Connection: close\r\n"+
+		"\r\n"+
+		"hello world", buf.String())
+	assert.Equal(t, "chunked", h.Get("Transfer-Encoding"))
+	assert.Equal(t, "X-Checksum", h.Get("Trailer"))
+
+	// Test: Informational responses aren't sent
+	w = &Writer{Writer: &bytes.Buffer{}, HttpVersion: "1.0"}
+	require.Error(t, w.WriteStatusLine(Continue))
+}
+
+func TestDiscard(t *testing.T) {
+	// Test: Everything pending is dropped for the replacement response
+	buf := &bytes.Buffer{}
+	w := &Writer{Writer: buf}
+	require.NoError(t, w.SetStatus(Created))
+	w.Headers().Set("X-Pending", "1")
+	w.Write([]byte("dropped"))
+	require.NoError(t, w.Discard())
+	require.NoError(t, w.DeclareTrailer("X-Checksum"))
+	require.NoError(t, w.Discard())
+	w.Write([]byte("kept"))
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 4\r\n\r\nkept", buf.String())
+
+	// Test: A status line waiting for its headers is dropped too
+	buf = &bytes.Buffer{}
+	w = &Writer{Writer: buf}
+	require.NoError(t, w.WriteStatusLine(Success))
+	require.NoError(t, w.Discard())
+	require.NoError(t, w.WriteStatusLine(NotFound))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(0)))
+	assert.True(t, strings.HasPrefix(buf.String(), "HTTP/1.1 404 Not Found\r\n"))
+
+	// Test: A response that started can't be discarded
+	require.Error(t, w.Discard())
+}
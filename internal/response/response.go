@@ -3,18 +3,61 @@ package response
 import (
 	"errors"
 	"io"
+	"slices"
 	"strconv"
+	"strings"
 
 	"github.com/sambakker4/httpfromtcp/internal/headers"
 )
 
-type StatusCode int
 type WriterState int
 
 type Writer struct {
 	StatusCode StatusCode
 	state      WriterState
 	Writer     io.Writer
+
+	// CloseConnection is set when the connection must be closed after this
+	// response, either because the server asked for it or because the
+	// response headers don't allow the connection to be reused.
+	CloseConnection bool
+
+	// OmitBody discards everything written after the headers, as needed
+	// for responses to HEAD requests.
+	OmitBody bool
+
+	// HttpVersion is the HTTP version of the request being answered, such
+	// as "1.0". HTTP/1.0 requests are answered as HTTP/1.0, with bodies of
+	// unknown length delimited by closing the connection instead of
+	// chunked. Anything else is answered as HTTP/1.1.
+	HttpVersion string
+
+	// MaxChunkSize limits the size of the chunks of a chunked body. With
+	// 0, every write is sent as one chunk.
+	MaxChunkSize int
+
+	headers      *headers.Headers
+	bytesWritten int64
+
+	// statusLine is the status line waiting to be sent with the headers,
+	// so a bad header can still be answered with another response.
+	statusLine []byte
+
+	// buf holds the body written before the headers were sent, so its
+	// length can be sent as the Content-Length.
+	buf []byte
+
+	// contentLength is the Content-Length that was sent, or -1 if the
+	// body isn't framed by a length.
+	contentLength int64
+
+	// chunks encodes the body when the headers declare chunked encoding.
+	chunks *ChunkedWriter
+
+	trailerNames []string
+	trailers     *headers.Headers
+
+	compression *compression
 }
 
 const (
@@ -23,13 +66,13 @@ const (
 	writerStateBody
 )
 
-const (
-	Success             StatusCode = 200
-	BadRequest          StatusCode = 400
-	InternalServerError StatusCode = 500
-)
+// write sends b to the connection as is. Once the headers are written
+// it discards b for responses without a body on the wire.
+func (w *Writer) write(b []byte) (int, error) {
+	if w.OmitBody && w.state == writerStateBody {
+		return len(b), nil
+	}
 
-func (w *Writer) Write(b []byte) (int, error) {
 	n, err := w.Writer.Write(b)
 	if err != nil {
 		return 0, err
@@ -38,54 +81,247 @@ func (w *Writer) Write(b []byte) (int, error) {
 	return n, nil
 }
 
+// WriteStatusLine writes the status line with the registered reason phrase
+// for statusCode. Codes that aren't registered are written with an empty
+// reason phrase.
 func (w *Writer) WriteStatusLine(statusCode StatusCode) error {
+	return w.WriteStatusLineReason(statusCode, StatusText(statusCode))
+}
+
+// WriteStatusLineReason writes the status line with a custom reason phrase.
+// It is sent together with the headers once they have been checked.
+func (w *Writer) WriteStatusLineReason(statusCode StatusCode, reason string) error {
 	if w.state != writerStateStatusLine {
 		return errors.New("error: writing request in the wrong order")
 	}
+
+	if !statusCode.Valid() {
+		return errors.New("error: status code must have three digits")
+	}
+
+	for _, char := range reason {
+		if char != '\t' && (char < ' ' || char == 0x7f) {
+			return errors.New("error: reason phrase contains control characters")
+		}
+	}
+
+	if statusCode.Informational() && w.http10() {
+		return errors.New("error: HTTP/1.0 clients don't accept informational responses")
+	}
+
+	// Body written with Write is waiting for headers of its own.
+	if len(w.buf) > 0 {
+		return errors.New("error: body was already written with Write")
+	}
+
 	w.state = writerStateHeaders
+	w.StatusCode = statusCode
 
-	switch statusCode {
-	case Success:
-		_, err := w.Write([]byte("HTTP/1.1 200 OK\r\n"))
-		return err
-	case BadRequest:
-		_, err := w.Write([]byte("HTTP/1.1 400 Bad Request\r\n"))
-		return err
-	case InternalServerError:
-		_, err := w.Write([]byte("HTTP/1.1 500 Internal Server Error\r\n"))
-		return err
-	default:
-		return errors.New("error: unknown status code")
+	version := "HTTP/1.1 "
+	if w.http10() {
+		version = "HTTP/1.0 "
 	}
+	w.statusLine = []byte(version + strconv.Itoa(int(statusCode)) + " " + reason + "\r\n")
+	return nil
 }
-func (w *Writer) WriteHeaders(headers headers.Headers) error {
+
+// wellKnownHeaders are written first, in this order. The other headers
+// follow in the order they were added.
+var wellKnownHeaders = []string{"Date", "Server", "Content-Type", "Content-Length"}
+
+// WriteHeaders writes the headers in a stable order with the names in the
+// case they were set with. The framing headers are adjusted on a copy, so
+// headers is left as it is.
+func (w *Writer) WriteHeaders(headers *headers.Headers) error {
 	if w.state != writerStateHeaders {
 		return errors.New("error: writing request in the wrong order")
 	}
-	w.state = writerStateBody
+	headers = headers.Clone()
+
+	compressed := false
+	if !w.StatusCode.Informational() {
+		length, err := parseContentLength(headers)
+		if err == nil && w.compressHeaders(headers, length) {
+			// The compressed length isn't known until the body is done.
+			headers.Del("Content-Length")
+			if !headers.HasToken("Transfer-Encoding", "chunked") {
+				headers.Set("Transfer-Encoding", "chunked")
+			}
+			compressed = true
+		}
+	}
 
-	for key, val := range headers {
-		_, err := w.Write([]byte(key + ": " + val + "\r\n"))
+	// HTTP/1.0 has no chunked encoding, so the body ends when the
+	// connection is closed, and there is nowhere to send trailers.
+	if w.http10() && !w.StatusCode.Informational() && headers.HasToken("Transfer-Encoding", "chunked") {
+		headers.Del("Transfer-Encoding")
+		headers.Del("Trailer")
+	}
+
+	err := headers.Validate()
+	if err != nil {
+		return err
+	}
+
+	contentLength, err := parseContentLength(headers)
+	if err != nil {
+		return err
+	}
+
+	if !w.StatusCode.Informational() {
+		err = w.addTrailerHeader(headers)
 		if err != nil {
 			return err
 		}
 	}
-	_, err := w.Write([]byte("\r\n"))
+
+	// An informational response is followed by the final response.
+	if w.StatusCode.Informational() {
+		defer func() { w.state = writerStateStatusLine }()
+	} else {
+		defer func() { w.state = writerStateBody }()
+		w.headers = headers
+		w.contentLength = contentLength
+		w.chunks = nil
+		if headers.HasToken("Transfer-Encoding", "chunked") {
+			w.chunkedWriter()
+		}
+
+		if compressed {
+			w.compression.encoder, err = w.compression.newEncoder(w.bodyWriter())
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if headers.HasToken("Connection", "close") {
+		w.CloseConnection = true
+	}
+
+	// Without a length or chunked framing the body ends when the
+	// connection is closed.
+	bodyFramed := contentLength >= 0 || headers.HasToken("Transfer-Encoding", "chunked")
+	if w.StatusCode.BodyAllowed() && !bodyFramed {
+		w.CloseConnection = true
+	}
+
+	out := w.statusLine
+	w.statusLine = nil
+	for _, name := range wellKnownHeaders {
+		for key, val := range headers.All() {
+			if strings.EqualFold(key, name) {
+				out = append(out, key+": "+val+"\r\n"...)
+			}
+		}
+	}
+
+	for key, val := range headers.All() {
+		if slices.ContainsFunc(wellKnownHeaders, func(name string) bool { return strings.EqualFold(key, name) }) {
+			continue
+		}
+		out = append(out, key+": "+val+"\r\n"...)
+	}
+
+	if w.CloseConnection && !headers.HasToken("Connection", "close") {
+		out = append(out, "Connection: close\r\n"...)
+	}
+
+	// HTTP/1.0 connections are closed unless the response says otherwise.
+	if w.http10() && !w.CloseConnection && !headers.HasToken("Connection", "keep-alive") {
+		out = append(out, "Connection: keep-alive\r\n"...)
+	}
+
+	out = append(out, "\r\n"...)
+	_, err = w.write(out)
 	return err
 }
+
 func (w *Writer) WriteBody(p []byte) (int, error) {
-	n, err := w.Write(p)
+	if w.state != writerStateBody {
+		return 0, errors.New("error: writing request in the wrong order")
+	}
+
+	if len(p) > 0 && !w.StatusCode.BodyAllowed() {
+		return 0, errors.New("error: status code does not allow a body")
+	}
+
+	if enc := w.bodyEncoder(); enc != nil {
+		n, err := enc.Write(p)
+		w.bytesWritten += int64(n)
+		return n, err
+	}
+
+	if w.contentLength >= 0 && w.bytesWritten+int64(len(p)) > w.contentLength {
+		return 0, errors.New("error: body is longer than its Content-Length")
+	}
+
+	n, err := w.write(p)
 	if err != nil {
 		return 0, err
 	}
+	w.bytesWritten += int64(n)
 	return n, nil
 }
 
-func GetDefaultHeaders(contentLen int) headers.Headers {
+func (w *Writer) http10() bool {
+	return w.HttpVersion == "1.0"
+}
+
+// Headers returns the response headers. Until the headers are sent they
+// can be changed to set the headers Write, Flush and Finish send; after
+// that they are the headers that were written.
+func (w *Writer) Headers() *headers.Headers {
+	if w.headers == nil {
+		w.headers = headers.NewHeaders()
+	}
+	return w.headers
+}
+
+// Started reports whether the final response has started to be sent,
+// after which it can no longer be replaced by another one. A status line
+// waiting for its headers hasn't been sent yet.
+func (w *Writer) Started() bool {
+	return w.state == writerStateBody
+}
+
+// statusWritten reports whether the final status line was written, even if
+// it is still waiting for the headers.
+func (w *Writer) statusWritten() bool {
+	return w.state != writerStateStatusLine
+}
+
+// BytesWritten returns the number of body bytes written so far, including
+// buffered ones and not counting chunked framing.
+func (w *Writer) BytesWritten() int64 {
+	return w.bytesWritten
+}
+
+func GetDefaultHeaders(contentLen int) *headers.Headers {
 	headers := headers.NewHeaders()
-	headers["content-length"] = strconv.Itoa(contentLen)
-	headers["connection"] = "close"
-	headers["content-type"] = "text/plain"
+	headers.Set("Content-Length", strconv.Itoa(contentLen))
+	headers.Set("Content-Type", "text/plain")
 
 	return headers
 }
+
+// parseContentLength returns the Content-Length in h, or -1 if there is
+// none.
+func parseContentLength(h *headers.Headers) (int64, error) {
+	values := h.Values("Content-Length")
+	if values == nil {
+		return -1, nil
+	}
+
+	for _, value := range values[1:] {
+		if value != values[0] {
+			return 0, errors.New("error: conflicting Content-Length values")
+		}
+	}
+
+	length, err := strconv.ParseInt(values[0], 10, 64)
+	if err != nil || length < 0 {
+		return 0, errors.New("error: invalid Content-Length")
+	}
+	return length, nil
+}
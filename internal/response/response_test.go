@@ -0,0 +1,155 @@
+package response
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/sambakker4/httpfromtcp/internal/headers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteStatusLine(t *testing.T) {
+	tests := []struct {
+		code StatusCode
+		line string
+	}{
+		{Success, "HTTP/1.1 200 OK\r\n"},
+		{Created, "HTTP/1.1 201 Created\r\n"},
+		{NoContent, "HTTP/1.1 204 No Content\r\n"},
+		{MovedPermanently, "HTTP/1.1 301 Moved Permanently\r\n"},
+		{NotModified, "HTTP/1.1 304 Not Modified\r\n"},
+		{NotFound, "HTTP/1.1 404 Not Found\r\n"},
+		{TooManyRequests, "HTTP/1.1 429 Too Many Requests\r\n"},
+		{ServiceUnavailable, "HTTP/1.1 503 Service Unavailable\r\n"},
+		{299, "HTTP/1.1 299 \r\n"},
+	}
+
+	for _, tt := range tests {
+		buf := &bytes.Buffer{}
+		w := &Writer{Writer: buf}
+		require.NoError(t, w.WriteStatusLine(tt.code))
+		assert.Equal(t, tt.code, w.StatusCode)
+		require.NoError(t, w.WriteHeaders(headers.NewHeaders()))
+		assert.True(t, strings.HasPrefix(buf.String(), tt.line), buf.String())
+	}
+
+	// Test: Custom reason phrase
+	buf := &bytes.Buffer{}
+	w := &Writer{Writer: buf}
+	require.NoError(t, w.WriteStatusLineReason(299, "Custom Thing"))
+	require.NoError(t, w.WriteHeaders(headers.NewHeaders()))
+	assert.True(t, strings.HasPrefix(buf.String(), "HTTP/1.1 299 Custom Thing\r\n"), buf.String())
+
+	// Test: The status line waits for the headers
+	buf = &bytes.Buffer{}
+	w = &Writer{Writer: buf}
+	require.NoError(t, w.WriteStatusLine(Success))
+	assert.Equal(t, 0, buf.Len())
+	assert.False(t, w.Started())
+
+	// Test: Invalid status codes and reasons
+	w = &Writer{Writer: &bytes.Buffer{}}
+	require.Error(t, w.WriteStatusLine(99))
+	require.Error(t, w.WriteStatusLine(1000))
+	require.Error(t, w.WriteStatusLineReason(200, "OK\r\nX-Injected: 1"))
+}
+
+func TestBodyAllowed(t *testing.T) {
+	assert.False(t, Continue.BodyAllowed())
+	assert.False(t, NoContent.BodyAllowed())
+	assert.False(t, NotModified.BodyAllowed())
+	assert.True(t, Success.BodyAllowed())
+	assert.True(t, NotFound.BodyAllowed())
+
+	// Test: Writing a body with 204 is rejected
+	buf := &bytes.Buffer{}
+	w := &Writer{Writer: buf}
+	require.NoError(t, w.WriteStatusLine(NoContent))
+	require.NoError(t, w.WriteHeaders(headers.NewHeaders()))
+	_, err := w.WriteBody([]byte("body"))
+	require.Error(t, err)
+	assert.False(t, w.CloseConnection)
+	assert.Equal(t, "HTTP/1.1 204 No Content\r\n\r\n", buf.String())
+}
+
+func TestInformationalResponse(t *testing.T) {
+	// Test: A 1xx response is followed by the final response
+	buf := &bytes.Buffer{}
+	w := &Writer{Writer: buf}
+	require.NoError(t, w.WriteStatusLine(Continue))
+	require.NoError(t, w.WriteHeaders(headers.NewHeaders()))
+	require.NoError(t, w.WriteStatusLine(Success))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(2)))
+	_, err := w.WriteBody([]byte("ok"))
+	require.NoError(t, err)
+	assert.Contains(t, buf.String(), "HTTP/1.1 100 Continue\r\n\r\nHTTP/1.1 200 OK\r\n")
+}
+
+func TestWriteHeadersOrder(t *testing.T) {
+	h := headers.NewHeaders()
+	h.Set("X-Request-Id", "abc")
+	h.Set("Content-Length", "2")
+	h.Set("ETag", `"v1"`)
+	h.Set("Content-Type", "text/plain")
+	h.Set("Server", "httpfromtcp")
+	h.Set("Date", "Sun, 18 Oct 2026 12:00:00 GMT")
+
+	// Test: Well-known headers first, then insertion order, same output every time
+	for range 10 {
+		buf := &bytes.Buffer{}
+		w := &Writer{Writer: buf}
+		require.NoError(t, w.WriteStatusLine(Success))
+		require.NoError(t, w.WriteHeaders(h))
+		assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+			"Date: Sun, 18 Oct 2026 12:00:00 GMT\r\n"+
+			"Server: httpfromtcp\r\n"+
+			"Content-Type: text/plain\r\n"+
+			"Content-Length: 2\r\n"+
+			"X-Request-Id: abc\r\n"+
+			"ETag: \"v1\"\r\n"+
+			"\r\n", buf.String())
+	}
+}
+
+func TestWriteHeadersMultipleValues(t *testing.T) {
+	h := headers.NewHeaders()
+	h.Set("Content-Length", "0")
+	h.Add("Set-Cookie", "a=1; Path=/")
+	h.Add("Set-Cookie", "b=2; Expires=Sun, 18 Oct 2026 12:00:00 GMT")
+
+	// Test: Every value is written on its own line
+	buf := &bytes.Buffer{}
+	w := &Writer{Writer: buf}
+	require.NoError(t, w.WriteStatusLine(Success))
+	require.NoError(t, w.WriteHeaders(h))
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Content-Length: 0\r\n"+
+		"Set-Cookie: a=1; Path=/\r\n"+
+		"Set-Cookie: b=2; Expires=Sun, 18 Oct 2026 12:00:00 GMT\r\n"+
+		"\r\n", buf.String())
+}
+
+func TestWriteHeadersInjection(t *testing.T) {
+	h := GetDefaultHeaders(0)
+	h.Set("Location", "/next\r\nSet-Cookie: session=stolen")
+
+	// Test: Invalid values are rejected before anything is written
+	buf := &bytes.Buffer{}
+	w := &Writer{Writer: buf}
+	require.NoError(t, w.WriteStatusLine(Found))
+	require.Error(t, w.WriteHeaders(h))
+	assert.Equal(t, 0, buf.Len())
+	assert.False(t, w.Started())
+
+	// Test: The headers can still be written once fixed
+	h.Set("Location", "/next")
+	require.NoError(t, w.WriteHeaders(h))
+	assert.NotContains(t, buf.String(), "Set-Cookie")
+
+	// Test: Trailers are validated too
+	trailers := headers.NewHeaders()
+	trailers.Set("X-Checksum", "abc\x00")
+	require.Error(t, w.WriteTrailers(trailers))
+}
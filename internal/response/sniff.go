@@ -0,0 +1,80 @@
+package response
+
+import (
+	"bytes"
+	"strings"
+	"unicode/utf8"
+)
+
+// signatures are the leading bytes of common binary formats.
+var signatures = []struct {
+	prefix      string
+	contentType string
+}{
+	{"\x89PNG\r\n\x1a\n", "image/png"},
+	{"\xff\xd8\xff", "image/jpeg"},
+	{"GIF87a", "image/gif"},
+	{"GIF89a", "image/gif"},
+	{"%PDF-", "application/pdf"},
+	{"\x1f\x8b\x08", "application/x-gzip"},
+	{"PK\x03\x04", "application/zip"},
+	{"wOF2", "font/woff2"},
+	{"OggS\x00", "application/ogg"},
+	{"\x1aE\xdf\xa3", "video/webm"},
+}
+
+// htmlPrefixes start an HTML document, ignoring case and leading
+// whitespace.
+var htmlPrefixes = []string{"<!doctype html", "<html", "<head", "<body", "<title", "<p", "<div", "<!--"}
+
+// sniffContentType guesses the type of content from its first bytes. It
+// knows a few binary signatures, HTML, XML and plain text, and falls back
+// to application/octet-stream.
+func sniffContentType(data []byte) string {
+	for _, sig := range signatures {
+		if bytes.HasPrefix(data, []byte(sig.prefix)) {
+			return sig.contentType
+		}
+	}
+
+	if len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP" {
+		return "image/webp"
+	}
+
+	text := bytes.TrimLeft(data, "\t\n\f\r ")
+	lower := bytes.ToLower(text[:min(len(text), 16)])
+	for _, prefix := range htmlPrefixes {
+		if !bytes.HasPrefix(lower, []byte(prefix)) {
+			continue
+		}
+		// The tag name has to end here, so "<pre" isn't taken for "<p".
+		if len(lower) == len(prefix) || prefix == "<!--" || strings.IndexByte(" >", lower[len(prefix)]) != -1 {
+			return "text/html; charset=utf-8"
+		}
+	}
+	if bytes.HasPrefix(text, []byte("<?xml")) {
+		return "text/xml; charset=utf-8"
+	}
+
+	if isText(data) {
+		return "text/plain; charset=utf-8"
+	}
+	return "application/octet-stream"
+}
+
+// isText reports whether data is UTF-8 without control characters other
+// than whitespace and escape. A rune cut off at the end is allowed, since
+// data may be the start of longer content.
+func isText(data []byte) bool {
+	for len(data) > 0 {
+		r, size := utf8.DecodeRune(data)
+		if r == utf8.RuneError && size == 1 {
+			return !utf8.FullRune(data)
+		}
+		if r < ' ' && strings.IndexByte("\t\n\f\r\x1b", byte(r)) == -1 || r == 0x7f {
+			return false
+		}
+		data = data[size:]
+	}
+	return true
+}
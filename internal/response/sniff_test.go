@@ -0,0 +1,36 @@
+package response
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSniffContentType(t *testing.T) {
+	tests := []struct {
+		data        string
+		contentType string
+	}{
+		{"", "text/plain; charset=utf-8"},
+		{"hello, world\n", "text/plain; charset=utf-8"},
+		{"caf\xc3\xa9", "text/plain; charset=utf-8"},
+		{"cut off \xe2\x9c", "text/plain; charset=utf-8"},
+		{"  <!DOCTYPE HTML><html></html>", "text/html; charset=utf-8"},
+		{"<html><body>hi</body></html>", "text/html; charset=utf-8"},
+		{"<p>a paragraph</p>", "text/html; charset=utf-8"},
+		{"<pre>not html</pre>", "text/plain; charset=utf-8"},
+		{"<?xml version=\"1.0\"?><feed/>", "text/xml; charset=utf-8"},
+		{"\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR", "image/png"},
+		{"\xff\xd8\xff\xe0\x00\x10JFIF", "image/jpeg"},
+		{"GIF89a\x01\x00", "image/gif"},
+		{"RIFF\x24\x00\x00\x00WEBPVP8 ", "image/webp"},
+		{"%PDF-1.7\n", "application/pdf"},
+		{"\x1f\x8b\x08\x00\x00\x00", "application/x-gzip"},
+		{"PK\x03\x04\x14\x00", "application/zip"},
+		{"\x00\x01\x02\x03", "application/octet-stream"},
+		{"\xc3\x28 invalid", "application/octet-stream"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.contentType, sniffContentType([]byte(tt.data)), "%q", tt.data)
+	}
+}
@@ -0,0 +1,130 @@
+package response
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/sambakker4/httpfromtcp/internal/headers"
+)
+
+// forbiddenTrailers are fields that must not be sent as trailers because
+// they frame the message, route or control it, or describe the content
+// before it is read.
+var forbiddenTrailers = map[string]bool{
+	"age":                 true,
+	"authorization":       true,
+	"cache-control":       true,
+	"content-encoding":    true,
+	"content-length":      true,
+	"content-range":       true,
+	"content-type":        true,
+	"date":                true,
+	"expect":              true,
+	"expires":             true,
+	"host":                true,
+	"location":            true,
+	"max-forwards":        true,
+	"pragma":              true,
+	"proxy-authenticate":  true,
+	"proxy-authorization": true,
+	"range":               true,
+	"retry-after":         true,
+	"set-cookie":          true,
+	"te":                  true,
+	"trailer":             true,
+	"transfer-encoding":   true,
+	"vary":                true,
+	"www-authenticate":    true,
+}
+
+// DeclareTrailer announces fields that are sent as trailers after the
+// body. They are listed in the Trailer header, which makes the body
+// chunked, and their values are set with SetTrailer while the body is
+// written.
+func (w *Writer) DeclareTrailer(names ...string) error {
+	if w.statusWritten() {
+		return errors.New("error: trailers must be declared before the headers are written")
+	}
+
+	for _, name := range names {
+		if !headers.ValidName(name) {
+			return fmt.Errorf("error: invalid trailer name %q", name)
+		}
+		if forbiddenTrailers[strings.ToLower(name)] {
+			return fmt.Errorf("error: %s is not allowed as a trailer", name)
+		}
+	}
+
+	w.trailerNames = append(w.trailerNames, names...)
+	return nil
+}
+
+// SetTrailer sets the value of a declared trailer.
+func (w *Writer) SetTrailer(name string, value string) error {
+	if !w.trailerDeclared(name) {
+		return fmt.Errorf("error: trailer %s was not declared", name)
+	}
+
+	if w.trailers == nil {
+		w.trailers = headers.NewHeaders()
+	}
+	w.trailers.Set(name, value)
+	return nil
+}
+
+// trailerDeclared reports whether name was declared with DeclareTrailer
+// or in a Trailer header set by the handler.
+func (w *Writer) trailerDeclared(name string) bool {
+	declared := slices.ContainsFunc(w.trailerNames, func(n string) bool {
+		return strings.EqualFold(n, name)
+	})
+	return declared || (w.headers != nil && w.headers.HasToken("Trailer", name))
+}
+
+// addTrailerHeader lists the declared trailers in h. Trailers can only be
+// sent after a chunked body, so HTTP/1.0 responses go without them.
+func (w *Writer) addTrailerHeader(h *headers.Headers) error {
+	if len(w.trailerNames) == 0 || w.http10() {
+		return nil
+	}
+
+	if !h.HasToken("Transfer-Encoding", "chunked") {
+		return errors.New("error: trailers need a chunked body")
+	}
+
+	var missing []string
+	for _, name := range w.trailerNames {
+		if !h.HasToken("Trailer", name) && !slices.Contains(missing, name) {
+			missing = append(missing, name)
+		}
+	}
+	if missing != nil {
+		h.Add("Trailer", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// sendsTrailers reports whether declared trailers will be sent, which
+// needs a chunked body.
+func (w *Writer) sendsTrailers() bool {
+	return w.trailerNames != nil && !w.http10()
+}
+
+// checkTrailers makes sure every field in h may be sent as a trailer.
+func (w *Writer) checkTrailers(h *headers.Headers) error {
+	if w.chunks == nil {
+		return errors.New("error: trailers need a chunked body")
+	}
+
+	for name := range h.All() {
+		if forbiddenTrailers[strings.ToLower(name)] {
+			return fmt.Errorf("error: %s is not allowed as a trailer", name)
+		}
+		if !w.trailerDeclared(name) {
+			return fmt.Errorf("error: trailer %s was not declared", name)
+		}
+	}
+	return nil
+}
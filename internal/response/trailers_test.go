@@ -0,0 +1,72 @@
+package response
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/sambakker4/httpfromtcp/internal/headers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrailers(t *testing.T) {
+	// Test: Declared trailers are listed in the Trailer header and sent
+	// after the body
+	buf := &bytes.Buffer{}
+	w := &Writer{Writer: buf}
+	require.NoError(t, w.DeclareTrailer("X-Checksum", "X-Length"))
+	w.Write([]byte("hello"))
+	require.NoError(t, w.SetTrailer("x-checksum", "abc"))
+	require.NoError(t, w.SetTrailer("X-Length", "5"))
+	require.NoError(t, w.Finish())
+	assert.Contains(t, buf.String(), "\r\nTrailer: X-Checksum, X-Length\r\n")
+
+	resp, body := readResponse(t, buf)
+	assert.Equal(t, "hello", body)
+	assert.Equal(t, "abc", resp.Trailer.Get("X-Checksum"))
+	assert.Equal(t, "5", resp.Trailer.Get("X-Length"))
+
+	// Test: Undeclared and forbidden trailers
+	w = &Writer{Writer: &bytes.Buffer{}}
+	require.Error(t, w.DeclareTrailer("Content-Length"))
+	require.Error(t, w.DeclareTrailer("Bad Name"))
+	require.NoError(t, w.DeclareTrailer("X-Checksum"))
+	require.Error(t, w.SetTrailer("X-Other", "1"))
+
+	// Test: Trailers can't be declared after the headers
+	require.NoError(t, w.Flush())
+	require.Error(t, w.DeclareTrailer("X-Late"))
+
+	// Test: Trailers need a chunked body
+	buf = &bytes.Buffer{}
+	w = &Writer{Writer: buf}
+	require.NoError(t, w.DeclareTrailer("X-Checksum"))
+	w.Headers().Set("Content-Length", "5")
+	_, err := w.Write([]byte("hello"))
+	require.Error(t, err)
+	assert.False(t, w.Started())
+	assert.Equal(t, 0, buf.Len())
+
+	// Test: WriteTrailers checks the fields against the Trailer header
+	buf = &bytes.Buffer{}
+	w = &Writer{Writer: buf}
+	h := headers.NewHeaders()
+	h.Set("Transfer-Encoding", "chunked")
+	h.Set("Trailer", "X-Checksum")
+	require.NoError(t, w.WriteStatusLine(Success))
+	require.NoError(t, w.WriteHeaders(h))
+
+	trailers := headers.NewHeaders()
+	trailers.Set("X-Other", "1")
+	require.Error(t, w.WriteTrailers(trailers))
+
+	trailers = headers.NewHeaders()
+	trailers.Set("Content-Length", "1")
+	require.Error(t, w.WriteTrailers(trailers))
+
+	trailers = headers.NewHeaders()
+	trailers.Set("X-Checksum", "abc")
+	require.NoError(t, w.WriteTrailers(trailers))
+	resp, _ = readResponse(t, buf)
+	assert.Equal(t, "abc", resp.Trailer.Get("X-Checksum"))
+}
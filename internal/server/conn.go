@@ -0,0 +1,51 @@
+package server
+
+import (
+	"net"
+	"time"
+)
+
+// serverConn wraps an accepted connection. When the first byte of a request
+// arrives it marks the connection active, so Shutdown doesn't close it in
+// the middle of a request, and swaps the idle read deadline for the header
+// deadline.
+type serverConn struct {
+	net.Conn
+	server *Server
+
+	// waiting is set while the connection is between requests.
+	waiting      bool
+	requestStart time.Time
+	writeErr     error
+}
+
+func (c *serverConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 && c.waiting {
+		c.startRequest()
+	}
+	return n, err
+}
+
+func (c *serverConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	if err != nil && c.writeErr == nil {
+		c.writeErr = err
+	}
+	return n, err
+}
+
+func (c *serverConn) startRequest() {
+	c.waiting = false
+	c.requestStart = time.Now()
+	c.server.setConnState(c.Conn, connStateActive)
+	c.Conn.SetReadDeadline(deadline(c.requestStart, c.server.headerTimeout()))
+}
+
+// waitForRequest puts the connection back in the idle state after a
+// response.
+func (c *serverConn) waitForRequest() {
+	c.waiting = true
+	c.server.setConnState(c.Conn, connStateIdle)
+	c.Conn.SetReadDeadline(deadline(time.Now(), c.server.keepAliveTimeout()))
+}
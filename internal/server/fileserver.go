@@ -0,0 +1,227 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/sambakker4/httpfromtcp/internal/request"
+	"github.com/sambakker4/httpfromtcp/internal/response"
+)
+
+const indexFile = "index.html"
+
+// FileServer serves the files of a file system under a URL prefix, so a
+// request for prefix+"/css/site.css" gets the file "css/site.css". Paths
+// that try to leave the root are rejected, a directory is served through
+// its index.html or, if Listing is set, a listing of its files, and
+// conditional and range requests are handled by response.ServeContent.
+//
+// Any fs.FS works, such as os.DirFS or an embed.FS. os.DirFS follows
+// symlinks that point out of the directory; use Dir to refuse them.
+type FileServer struct {
+	// Listing renders an HTML listing for directories without an
+	// index.html.
+	Listing bool
+
+	prefix string
+	root   fs.FS
+}
+
+func NewFileServer(prefix string, root fs.FS) *FileServer {
+	return &FileServer{
+		prefix: strings.TrimSuffix(prefix, "/"),
+		root:   root,
+	}
+}
+
+func (fsrv *FileServer) ServeHTTP(w *response.Writer, req *request.Request) {
+	method := req.RequestLine.Method
+	if method != "GET" && method != "HEAD" {
+		body := "Method Not Allowed\n"
+		headers := response.GetDefaultHeaders(len(body))
+		headers.Set("Allow", "GET, HEAD")
+		w.WriteStatusLine(response.MethodNotAllowed)
+		w.WriteHeaders(headers)
+		w.WriteBody([]byte(body))
+		return
+	}
+
+	target := req.RequestLine.Target
+	name, status := fsrv.resolve(target)
+	if status != 0 {
+		HandlerError{StatusCode: status, Message: response.StatusText(status)}.Write(w)
+		return
+	}
+
+	f, err := fsrv.root.Open(name)
+	if err != nil {
+		fileError(w, err)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		fileError(w, err)
+		return
+	}
+
+	isDirTarget := strings.HasSuffix(target.Path, "/")
+	if !info.IsDir() {
+		if isDirTarget {
+			HandlerError{StatusCode: response.NotFound, Message: "Not Found"}.Write(w)
+			return
+		}
+		serveFile(w, req, f, info)
+		return
+	}
+
+	// Relative links in a directory's page only work with the slash.
+	if !isDirTarget {
+		headers := response.GetDefaultHeaders(0)
+		headers.Set("Location", target.RawPath+"/")
+		w.WriteStatusLine(response.MovedPermanently)
+		w.WriteHeaders(headers)
+		return
+	}
+
+	index, err := fsrv.root.Open(path.Join(name, indexFile))
+	if err == nil {
+		defer index.Close()
+		indexInfo, err := index.Stat()
+		if err == nil && !indexInfo.IsDir() {
+			serveFile(w, req, index, indexInfo)
+			return
+		}
+	}
+
+	if !fsrv.Listing {
+		HandlerError{StatusCode: response.Forbidden, Message: "Forbidden"}.Write(w)
+		return
+	}
+	fsrv.serveListing(w, target.Path, name)
+}
+
+// resolve turns the path of a request target into a name in the root. It
+// returns a status code instead when the path is outside the prefix or
+// tries to leave the root.
+func (fsrv *FileServer) resolve(target request.Target) (string, response.StatusCode) {
+	if target.Form != request.OriginForm && target.Form != request.AbsoluteForm {
+		return "", response.BadRequest
+	}
+
+	// An encoded slash or backslash would be a separator only after
+	// decoding, hiding ".." segments from the checks below.
+	lower := strings.ToLower(target.RawPath)
+	if strings.Contains(lower, "%2f") || strings.Contains(lower, "%5c") {
+		return "", response.BadRequest
+	}
+
+	p := target.Path
+	if p != fsrv.prefix && !strings.HasPrefix(p, fsrv.prefix+"/") {
+		return "", response.NotFound
+	}
+
+	name := strings.Trim(strings.TrimPrefix(p, fsrv.prefix), "/")
+	if name == "" {
+		return ".", 0
+	}
+
+	if strings.ContainsAny(name, "\\\x00") || !fs.ValidPath(name) {
+		return "", response.BadRequest
+	}
+	return name, 0
+}
+
+func fileError(w *response.Writer, err error) {
+	status := response.InternalServerError
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		status = response.NotFound
+	case errors.Is(err, fs.ErrPermission):
+		status = response.Forbidden
+	}
+	HandlerError{StatusCode: status, Message: response.StatusText(status)}.Write(w)
+}
+
+// serveFile serves an open file, reading it into memory if the file
+// system's files can't seek.
+func serveFile(w *response.Writer, req *request.Request, f fs.File, info fs.FileInfo) {
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		data, err := io.ReadAll(f)
+		if err != nil {
+			fileError(w, err)
+			return
+		}
+		content = bytes.NewReader(data)
+	}
+
+	if !info.ModTime().IsZero() {
+		etag := strconv.FormatInt(info.ModTime().UnixNano(), 16) + "-" + strconv.FormatInt(info.Size(), 16)
+		w.Headers().Set("ETag", `"`+etag+`"`)
+	}
+	response.ServeContent(w, req, info.Name(), info.ModTime(), content)
+}
+
+func (fsrv *FileServer) serveListing(w *response.Writer, target string, name string) {
+	entries, err := fs.ReadDir(fsrv.root, name)
+	if err != nil {
+		fileError(w, err)
+		return
+	}
+
+	title := html.EscapeString(target)
+	var page strings.Builder
+	fmt.Fprintf(&page, "<!DOCTYPE html>\n<html>\n<head><title>Index of %s</title></head>\n<body>\n<h1>Index of %s</h1>\n<ul>\n", title, title)
+	if name != "." {
+		page.WriteString("<li><a href=\"../\">../</a></li>\n")
+	}
+	for _, entry := range entries {
+		entryName := entry.Name()
+		if entry.IsDir() {
+			entryName += "/"
+		}
+		href := (&url.URL{Path: entryName}).EscapedPath()
+		fmt.Fprintf(&page, "<li><a href=\"%s\">%s</a></li>\n", html.EscapeString(href), html.EscapeString(entryName))
+	}
+	page.WriteString("</ul>\n</body>\n</html>\n")
+
+	w.Headers().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(page.String()))
+}
+
+// Dir serves a directory on disk like os.DirFS, but refuses to open files
+// whose path leads out of the directory through a symlink.
+type Dir string
+
+func (d Dir) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	root, err := filepath.EvalSymlinks(string(d))
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	resolved, err := filepath.EvalSymlinks(filepath.Join(root, filepath.FromSlash(name)))
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	if resolved != root && !strings.HasPrefix(resolved, root+string(filepath.Separator)) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+	}
+	return os.Open(resolved)
+}
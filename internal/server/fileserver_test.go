@@ -0,0 +1,137 @@
+package server
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileServer(t *testing.T) {
+	modtime := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	root := fstest.MapFS{
+		"site.css":         {Data: []byte("body { color: red; }"), ModTime: modtime},
+		"docs/index.html":  {Data: []byte("<h1>Docs</h1>"), ModTime: modtime},
+		"files/a <b>.txt":  {Data: []byte("a"), ModTime: modtime},
+		"files/sub/b.json": {Data: []byte("{}"), ModTime: modtime},
+	}
+	fileServer := NewFileServer("/static/", root)
+	fileServer.Listing = true
+
+	router := NewRouter()
+	router.Handle("/static/*path", fileServer.ServeHTTP)
+	_, addr := startServer(t, router.ServeHTTP)
+
+	// Test: A file with its type by extension
+	resp, body, err := roundTrip(addr, "GET", "/static/site.css", "")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "body { color: red; }", body)
+	assert.Equal(t, "text/css; charset=utf-8", resp.Header.Get("Content-Type"))
+	etag := resp.Header.Get("ETag")
+	assert.NotEmpty(t, etag)
+
+	// Test: Conditional requests
+	resp, _, err = roundTrip(addr, "GET", "/static/site.css", "If-None-Match: "+etag+"\r\n")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+	resp, _, err = roundTrip(addr, "GET", "/static/site.css", "If-Modified-Since: Sun, 18 Oct 2026 12:00:00 GMT\r\n")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+	resp, _, err = roundTrip(addr, "GET", "/static/site.css", "If-Modified-Since: Sat, 17 Oct 2026 12:00:00 GMT\r\n")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Test: Range requests
+	resp, body, err = roundTrip(addr, "GET", "/static/site.css", "Range: bytes=0-3\r\n")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusPartialContent, resp.StatusCode)
+	assert.Equal(t, "body", body)
+
+	// Test: Directories are served through their index.html
+	resp, body, err = roundTrip(addr, "GET", "/static/docs/", "")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "<h1>Docs</h1>", body)
+
+	// Test: A directory without the trailing slash is redirected
+	resp, _, err = roundTrip(addr, "GET", "/static/docs", "")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusMovedPermanently, resp.StatusCode)
+	assert.Equal(t, "/static/docs/", resp.Header.Get("Location"))
+
+	// Test: Directory listing with escaped names
+	resp, body, err = roundTrip(addr, "GET", "/static/files/", "")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/html; charset=utf-8", resp.Header.Get("Content-Type"))
+	assert.Contains(t, body, `<a href="a%20%3Cb%3E.txt">a &lt;b&gt;.txt</a>`)
+	assert.Contains(t, body, `<a href="sub/">sub/</a>`)
+
+	// Test: Listing can be turned off
+	fileServer.Listing = false
+	resp, _, err = roundTrip(addr, "GET", "/static/files/", "")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	// Test: Missing files
+	resp, _, err = roundTrip(addr, "GET", "/static/missing.css", "")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// Test: HEAD and other methods
+	resp, body, err = roundTrip(addr, "HEAD", "/static/site.css", "")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, int64(20), resp.ContentLength)
+	assert.Empty(t, body)
+	resp, _, err = roundTrip(addr, "POST", "/static/site.css", "")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
+
+func TestFileServerTraversal(t *testing.T) {
+	parent := t.TempDir()
+	root := filepath.Join(parent, "public")
+	require.NoError(t, os.Mkdir(root, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(parent, "secret.txt"), []byte("secret"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "ok.txt"), []byte("ok"), 0o644))
+	require.NoError(t, os.Symlink(filepath.Join(parent, "secret.txt"), filepath.Join(root, "escape.txt")))
+	require.NoError(t, os.Symlink("ok.txt", filepath.Join(root, "inside.txt")))
+
+	_, addr := startServer(t, NewFileServer("/files", Dir(root)).ServeHTTP)
+
+	// Test: Files and symlinks inside the root are served
+	resp, body, err := roundTrip(addr, "GET", "/files/ok.txt", "")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "ok", body)
+	_, body, err = roundTrip(addr, "GET", "/files/inside.txt", "")
+	require.NoError(t, err)
+	assert.Equal(t, "ok", body)
+
+	// Test: Paths that leave the root are rejected
+	tests := []struct {
+		target     string
+		statusCode int
+	}{
+		{"/files/../secret.txt", http.StatusBadRequest},
+		{"/files/%2e%2e/secret.txt", http.StatusBadRequest},
+		{"/files/..%2fsecret.txt", http.StatusBadRequest},
+		{"/files/..%5Csecret.txt", http.StatusBadRequest},
+		{"/files/escape.txt", http.StatusForbidden},
+		{"/other/ok.txt", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		resp, body, err := roundTrip(addr, "GET", tt.target, "")
+		require.NoError(t, err)
+		assert.Equal(t, tt.statusCode, resp.StatusCode, tt.target)
+		assert.NotContains(t, body, "secret\n", tt.target)
+		assert.NotEqual(t, "secret", body, tt.target)
+	}
+}
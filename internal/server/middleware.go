@@ -0,0 +1,111 @@
+package server
+
+import (
+	"compress/flate"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/sambakker4/httpfromtcp/internal/request"
+	"github.com/sambakker4/httpfromtcp/internal/response"
+)
+
+// Middleware wraps a Handler to run code before and after it. After the
+// wrapped handler returns, the response it produced can be inspected
+// through the Writer's Status, Headers and BytesWritten.
+type Middleware func(Handler) Handler
+
+// Chain composes middlewares into one. The first middleware is the
+// outermost, so it runs first on the way in and last on the way out.
+func Chain(middlewares ...Middleware) Middleware {
+	return func(handler Handler) Handler {
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			handler = middlewares[i](handler)
+		}
+		return handler
+	}
+}
+
+// WithMiddleware wraps the server's handler in middlewares, so they run
+// for every request.
+func WithMiddleware(middlewares ...Middleware) Option {
+	return func(s *Server) {
+		s.middlewares = append(s.middlewares, middlewares...)
+	}
+}
+
+// MaxBodyBytes overrides the server's body size limit for the requests it
+// wraps.
+func MaxBodyBytes(n int64) Middleware {
+	return func(next Handler) Handler {
+		return func(w *response.Writer, req *request.Request) {
+			req.MaxBodyBytes = n
+			next(w, req)
+		}
+	}
+}
+
+// DecompressBody decodes request bodies sent with a gzip or deflate
+// Content-Encoding before the handler reads them, allowing at most
+// maxBytes of decompressed body, or any amount if maxBytes is 0. Requests
+// with any other content coding get a 415 Unsupported Media Type.
+func DecompressBody(maxBytes int64) Middleware {
+	return func(next Handler) Handler {
+		return func(w *response.Writer, req *request.Request) {
+			err := req.DecompressBody(maxBytes)
+			if err != nil {
+				body := "Unsupported Media Type\n"
+				headers := response.GetDefaultHeaders(len(body))
+				headers.Set("Accept-Encoding", "gzip, deflate")
+				w.WriteStatusLine(response.UnsupportedMediaType)
+				w.WriteHeaders(headers)
+				w.WriteBody([]byte(body))
+				return
+			}
+
+			// Errors decoding the body are answered like errors reading it.
+			req.Body = &bodyReader{Reader: req.Body}
+			next(w, req)
+		}
+	}
+}
+
+// Compress compresses response bodies with gzip or deflate, as negotiated
+// from the request's Accept-Encoding. level is a compress/flate level and
+// bodies known to be shorter than minSize are sent as is. It panics if
+// level is invalid.
+func Compress(level int, minSize int) Middleware {
+	if level < flate.HuffmanOnly || level > flate.BestCompression {
+		panic("error: invalid compression level")
+	}
+
+	return func(next Handler) Handler {
+		return func(w *response.Writer, req *request.Request) {
+			acceptEncoding := strings.Join(req.Headers.Values("Accept-Encoding"), ",")
+			w.Compress(response.Compression{
+				Encoding: response.NegotiateEncoding(acceptEncoding),
+				Level:    level,
+				MinSize:  minSize,
+			})
+			next(w, req)
+		}
+	}
+}
+
+// LogRequests logs the method, target, status, body size and duration of
+// every request.
+func LogRequests(logger *log.Logger) Middleware {
+	return func(next Handler) Handler {
+		return func(w *response.Writer, req *request.Request) {
+			start := time.Now()
+			next(w, req)
+			logger.Printf("%s %s %d %d %s",
+				req.RequestLine.Method,
+				req.RequestLine.RequestTarget,
+				w.Status(),
+				w.BytesWritten(),
+				time.Since(start),
+			)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/sambakker4/httpfromtcp/internal/request"
+	"github.com/sambakker4/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChainOrder(t *testing.T) {
+	var calls []string
+	trace := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(w *response.Writer, req *request.Request) {
+				calls = append(calls, name+" in")
+				next(w, req)
+				calls = append(calls, name+" out")
+			}
+		}
+	}
+
+	handler := Chain(trace("a"), trace("b"))(func(w *response.Writer, req *request.Request) {
+		calls = append(calls, "handler")
+	})
+	handler(&response.Writer{}, &request.Request{})
+
+	assert.Equal(t, []string{"a in", "b in", "handler", "b out", "a out"}, calls)
+}
+
+func TestMiddlewareSeesResponse(t *testing.T) {
+	type result struct {
+		status      response.StatusCode
+		bytes       int64
+		contentType string
+	}
+	var mu sync.Mutex
+	var results []result
+
+	record := func(next Handler) Handler {
+		return func(w *response.Writer, req *request.Request) {
+			next(w, req)
+			mu.Lock()
+			defer mu.Unlock()
+			results = append(results, result{w.Status(), w.BytesWritten(), w.Headers().Get("Content-Type")})
+		}
+	}
+
+	auth := func(next Handler) Handler {
+		return func(w *response.Writer, req *request.Request) {
+			if req.Headers.Get("Authorization") == "" {
+				HandlerError{StatusCode: response.BadRequest, Message: "missing token"}.Write(w)
+				return
+			}
+			next(w, req)
+		}
+	}
+
+	router := NewRouter()
+	router.Use(record)
+	router.Handle("GET /public", func(w *response.Writer, req *request.Request) {
+		writeText(w, "hello")
+	})
+	router.Handle("GET /private", func(w *response.Writer, req *request.Request) {
+		writeText(w, "secret")
+	}, auth)
+	router.Handle("GET /empty", func(w *response.Writer, req *request.Request) {})
+	_, addr := startServer(t, router.ServeHTTP)
+
+	// Test: Global middleware sees the handler's response
+	resp, _, err := roundTrip(addr, "GET", "/public", "")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Test: Route middleware can answer instead of the handler
+	resp, body, err := roundTrip(addr, "GET", "/private", "")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, "missing token\n", body)
+
+	// Test: Global middleware also sees automatic responses
+	resp, _, err = roundTrip(addr, "GET", "/missing", "")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// Test: A handler that writes nothing is seen with its default status
+	resp, _, err = roundTrip(addr, "GET", "/empty", "")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []result{
+		{response.Success, 5, "text/plain"},
+		{response.BadRequest, int64(len("missing token\n")), "text/plain"},
+		{response.NotFound, int64(len("Not Found\n")), "text/plain"},
+		{response.Success, 0, ""},
+	}, results)
+}
+
+func TestServerMiddlewareAndBodyLimit(t *testing.T) {
+	var mu sync.Mutex
+	seen := 0
+	count := func(next Handler) Handler {
+		return func(w *response.Writer, req *request.Request) {
+			mu.Lock()
+			seen++
+			mu.Unlock()
+			next(w, req)
+		}
+	}
+
+	router := NewRouter()
+	router.Handle("GET /size", func(w *response.Writer, req *request.Request) {
+		writeText(w, strconv.FormatInt(req.MaxBodyBytes, 10))
+	}, MaxBodyBytes(1<<20))
+	_, addr := startServer(t, router.ServeHTTP, WithMiddleware(count))
+
+	// Test: A route overrides the body limit
+	_, body, err := roundTrip(addr, "GET", "/size", "")
+	require.NoError(t, err)
+	assert.Equal(t, "1048576", body)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 1, seen)
+}
+
+func TestCompressMiddleware(t *testing.T) {
+	page := strings.Repeat("<p>hello</p>", 200)
+	router := NewRouter()
+	router.Use(Compress(flate.DefaultCompression, 1024))
+	router.Handle("GET /page", func(w *response.Writer, req *request.Request) {
+		w.Headers().Set("Content-Type", "text/html")
+		w.Write([]byte(page))
+	})
+	_, addr := startServer(t, router.ServeHTTP)
+
+	// Test: Clients that accept gzip get a gzipped body
+	resp, body, err := roundTrip(addr, "GET", "/page", "Accept-Encoding: deflate;q=0.5, gzip\r\n")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", resp.Header.Get("Vary"))
+	gz, err := gzip.NewReader(strings.NewReader(body))
+	require.NoError(t, err)
+	decoded, err := io.ReadAll(gz)
+	require.NoError(t, err)
+	assert.Equal(t, page, string(decoded))
+
+	// Test: Other clients get the body as is
+	resp, body, err = roundTrip(addr, "GET", "/page", "")
+	require.NoError(t, err)
+	assert.Empty(t, resp.Header.Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", resp.Header.Get("Vary"))
+	assert.Equal(t, page, body)
+
+	// Test: The 500 for a panicking handler is a complete response
+	router = NewRouter()
+	router.Use(Compress(flate.DefaultCompression, 0))
+	router.Handle("GET /panic", func(w *response.Writer, req *request.Request) {
+		w.Headers().Set("Content-Type", "text/html")
+		panic("boom")
+	})
+	_, addr = startServer(t, router.ServeHTTP)
+	resp, body, err = roundTrip(addr, "GET", "/panic", "Accept-Encoding: gzip\r\n")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	gz, err = gzip.NewReader(strings.NewReader(body))
+	require.NoError(t, err)
+	decoded, err = io.ReadAll(gz)
+	require.NoError(t, err)
+	assert.Equal(t, "Internal Server Error\n", string(decoded))
+
+	// Test: Invalid levels are rejected up front
+	assert.Panics(t, func() { Compress(42, 0) })
+}
+
+func TestDecompressBodyMiddleware(t *testing.T) {
+	router := NewRouter()
+	router.Use(DecompressBody(1 << 20))
+	router.Handle("POST /upload", func(w *response.Writer, req *request.Request) {
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			return
+		}
+		writeText(w, string(body))
+	})
+	_, addr := startServer(t, router.ServeHTTP)
+
+	gzipped := func(data string) string {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		gz.Write([]byte(data))
+		gz.Close()
+		return buf.String()
+	}
+
+	tests := []struct {
+		name            string
+		contentEncoding string
+		body            string
+		statusCode      int
+		responseBody    string
+	}{
+		{"gzip body", "gzip", gzipped("hello world"), http.StatusOK, "hello world"},
+		{"Unknown coding", "br", "hello world", http.StatusUnsupportedMediaType, "Unsupported Media Type\n"},
+		{"Malformed gzip", "gzip", "hello world", http.StatusBadRequest, ""},
+		{"Decompressed body too large", "gzip", gzipped(strings.Repeat("a", 2<<20)), http.StatusRequestEntityTooLarge, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := net.Dial("tcp", addr)
+			require.NoError(t, err)
+			defer conn.Close()
+
+			_, err = conn.Write([]byte("POST /upload HTTP/1.1\r\nHost: localhost\r\nContent-Encoding: " + tt.contentEncoding +
+				"\r\nContent-Length: " + strconv.Itoa(len(tt.body)) + "\r\n\r\n" + tt.body))
+			require.NoError(t, err)
+
+			resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+			require.NoError(t, err)
+			assert.Equal(t, tt.statusCode, resp.StatusCode)
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			if tt.responseBody != "" {
+				assert.Equal(t, tt.responseBody, string(body))
+			}
+			if tt.statusCode == http.StatusUnsupportedMediaType {
+				assert.Equal(t, "gzip, deflate", resp.Header.Get("Accept-Encoding"))
+			}
+		})
+	}
+}
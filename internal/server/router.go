@@ -0,0 +1,278 @@
+package server
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/sambakker4/httpfromtcp/internal/headers"
+	"github.com/sambakker4/httpfromtcp/internal/request"
+	"github.com/sambakker4/httpfromtcp/internal/response"
+)
+
+// Router dispatches requests to handlers by method and path. Patterns look
+// like "GET /videos/{id}" or "/static/*path": the method is optional, a
+// {name} segment matches any single segment and a trailing *name matches
+// the rest of the path. Captured segments are available through
+// Request.PathValue.
+//
+// Requests for unknown paths get a 404 and requests with the wrong method
+// get a 405. HEAD requests are served by GET routes without the body, and
+// OPTIONS requests are answered with the allowed methods, or every method
+// the router serves for "OPTIONS *". Paths are matched after decoding, one
+// segment at a time.
+type Router struct {
+	routes      []*route
+	middlewares []Middleware
+}
+
+type segmentKind int
+
+// Segment kinds are ordered from most to least specific.
+const (
+	segmentLiteral segmentKind = iota
+	segmentParam
+	segmentWildcard
+)
+
+type segment struct {
+	kind  segmentKind
+	value string
+}
+
+type route struct {
+	method   string
+	segments []segment
+	handler  Handler
+}
+
+func NewRouter() *Router {
+	return &Router{}
+}
+
+// Use adds middlewares that run for every request the router serves,
+// including the automatic 404, 405 and OPTIONS responses.
+func (rt *Router) Use(middlewares ...Middleware) {
+	rt.middlewares = append(rt.middlewares, middlewares...)
+}
+
+// Handle registers handler for pattern, wrapped in middlewares. It panics
+// if the pattern is invalid or already registered.
+func (rt *Router) Handle(pattern string, handler Handler, middlewares ...Middleware) {
+	r, err := parsePattern(pattern)
+	if err != nil {
+		panic(err)
+	}
+	r.handler = Chain(middlewares...)(handler)
+
+	for _, existing := range rt.routes {
+		if existing.method == r.method && slices.Equal(existing.segments, r.segments) {
+			panic(fmt.Sprintf("error: pattern %q is already registered", pattern))
+		}
+	}
+	rt.routes = append(rt.routes, r)
+}
+
+func parsePattern(pattern string) (*route, error) {
+	method, path, found := strings.Cut(pattern, " ")
+	if !found {
+		method, path = "", pattern
+	}
+
+	if !strings.HasPrefix(path, "/") {
+		return nil, fmt.Errorf("error: pattern %q must start with a path", pattern)
+	}
+
+	r := &route{method: method}
+	names := map[string]bool{}
+	parts := strings.Split(path[1:], "/")
+	for i, part := range parts {
+		seg := segment{kind: segmentLiteral, value: part}
+		switch {
+		case strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}"):
+			seg = segment{kind: segmentParam, value: part[1 : len(part)-1]}
+		case strings.HasPrefix(part, "*"):
+			if i != len(parts)-1 {
+				return nil, fmt.Errorf("error: wildcard must be the last segment in %q", pattern)
+			}
+			seg = segment{kind: segmentWildcard, value: part[1:]}
+		}
+
+		if seg.kind != segmentLiteral {
+			if seg.value == "" || names[seg.value] {
+				return nil, fmt.Errorf("error: invalid parameter name in %q", pattern)
+			}
+			names[seg.value] = true
+		}
+		r.segments = append(r.segments, seg)
+	}
+	return r, nil
+}
+
+// match reports whether the route matches a path split into parts,
+// returning the captured parameters.
+func (r *route) match(parts []string) (map[string]string, bool) {
+	params := map[string]string{}
+	for i, seg := range r.segments {
+		if seg.kind == segmentWildcard {
+			params[seg.value] = strings.Join(parts[min(i, len(parts)):], "/")
+			return params, true
+		}
+
+		if i >= len(parts) {
+			return nil, false
+		}
+
+		switch seg.kind {
+		case segmentLiteral:
+			if parts[i] != seg.value {
+				return nil, false
+			}
+		case segmentParam:
+			if parts[i] == "" {
+				return nil, false
+			}
+			params[seg.value] = parts[i]
+		}
+	}
+	return params, len(parts) == len(r.segments)
+}
+
+// moreSpecific reports whether r should win over other when both match a
+// request for method.
+func (r *route) moreSpecific(other *route, method string) bool {
+	for i := 0; i < len(r.segments) && i < len(other.segments); i++ {
+		if r.segments[i].kind != other.segments[i].kind {
+			return r.segments[i].kind < other.segments[i].kind
+		}
+	}
+	if len(r.segments) != len(other.segments) {
+		return len(r.segments) > len(other.segments)
+	}
+	return r.methodRank(method) < other.methodRank(method)
+}
+
+// methodRank orders the ways a route can allow a method: the method
+// itself, then GET serving HEAD, then a route for any method. It returns
+// -1 if the route doesn't allow method.
+func (r *route) methodRank(method string) int {
+	switch {
+	case r.method == method:
+		return 0
+	case method == "HEAD" && r.method == "GET":
+		return 1
+	case r.method == "":
+		return 2
+	default:
+		return -1
+	}
+}
+
+func (rt *Router) ServeHTTP(w *response.Writer, req *request.Request) {
+	Chain(rt.middlewares...)(rt.dispatch)(w, req)
+}
+
+func (rt *Router) dispatch(w *response.Writer, req *request.Request) {
+	method := req.RequestLine.Method
+	switch req.RequestLine.Target.Form {
+	case request.AsteriskForm:
+		rt.serveOptions(w)
+		return
+	case request.AuthorityForm:
+		HandlerError{StatusCode: response.NotFound, Message: "Not Found"}.Write(w)
+		return
+	}
+	parts := splitPath(req.RequestLine.Target.RawPath)
+
+	var best *route
+	var bestParams map[string]string
+	var allowed []string
+	pathFound := false
+
+	for _, r := range rt.routes {
+		params, ok := r.match(parts)
+		if !ok {
+			continue
+		}
+		pathFound = true
+		allowed = append(allowed, r.method)
+
+		if r.methodRank(method) == -1 {
+			continue
+		}
+
+		if best == nil || r.moreSpecific(best, method) {
+			best = r
+			bestParams = params
+		}
+	}
+
+	if best != nil {
+		req.PathParams = bestParams
+		best.handler(w, req)
+		return
+	}
+
+	if !pathFound {
+		HandlerError{StatusCode: response.NotFound, Message: "Not Found"}.Write(w)
+		return
+	}
+
+	allow := allowHeader(allowed)
+	if method == "OPTIONS" {
+		headers := headers.NewHeaders()
+		headers.Set("Allow", allow)
+		w.WriteStatusLine(response.NoContent)
+		w.WriteHeaders(headers)
+		return
+	}
+
+	body := "Method Not Allowed\n"
+	headers := response.GetDefaultHeaders(len(body))
+	headers.Set("Allow", allow)
+	w.WriteStatusLine(response.MethodNotAllowed)
+	w.WriteHeaders(headers)
+	w.WriteBody([]byte(body))
+}
+
+// splitPath splits an encoded path into decoded segments. Splitting before
+// decoding keeps an encoded slash inside its segment.
+func splitPath(rawPath string) []string {
+	parts := strings.Split(strings.TrimPrefix(rawPath, "/"), "/")
+	for i, part := range parts {
+		decoded, err := url.PathUnescape(part)
+		if err == nil {
+			parts[i] = decoded
+		}
+	}
+	return parts
+}
+
+// serveOptions answers "OPTIONS *" with every method some route allows.
+func (rt *Router) serveOptions(w *response.Writer) {
+	var methods []string
+	for _, r := range rt.routes {
+		if r.method != "" {
+			methods = append(methods, r.method)
+		}
+	}
+
+	headers := headers.NewHeaders()
+	headers.Set("Allow", allowHeader(methods))
+	w.WriteStatusLine(response.NoContent)
+	w.WriteHeaders(headers)
+}
+
+// allowHeader lists the methods of the routes matching a path. A route
+// without a method would have matched, so it never ends up here.
+func allowHeader(methods []string) string {
+	if slices.Contains(methods, "GET") && !slices.Contains(methods, "HEAD") {
+		methods = append(methods, "HEAD")
+	}
+	if !slices.Contains(methods, "OPTIONS") {
+		methods = append(methods, "OPTIONS")
+	}
+	slices.Sort(methods)
+	return strings.Join(slices.Compact(methods), ", ")
+}
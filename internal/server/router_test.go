@@ -0,0 +1,90 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/sambakker4/httpfromtcp/internal/request"
+	"github.com/sambakker4/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRouter(t *testing.T) {
+	router := NewRouter()
+	router.Handle("GET /videos/{id}", func(w *response.Writer, req *request.Request) {
+		writeText(w, "video "+req.PathValue("id"))
+	})
+	router.Handle("DELETE /videos/{id}", func(w *response.Writer, req *request.Request) {
+		writeText(w, "deleted "+req.PathValue("id"))
+	})
+	router.Handle("GET /videos/latest", func(w *response.Writer, req *request.Request) {
+		writeText(w, "latest")
+	})
+	router.Handle("/static/*path", func(w *response.Writer, req *request.Request) {
+		writeText(w, "static "+req.PathValue("path"))
+	})
+	router.Handle("POST /upload", func(w *response.Writer, req *request.Request) {
+		writeText(w, "uploaded")
+	})
+	_, addr := startServer(t, router.ServeHTTP)
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		statusCode int
+		body       string
+		allow      string
+	}{
+		{"Path parameter", "GET", "/videos/42", 200, "video 42", ""},
+		{"Query string is ignored", "GET", "/videos/42?t=10", 200, "video 42", ""},
+		{"Literal wins over parameter", "GET", "/videos/latest", 200, "latest", ""},
+		{"Method picks the route", "DELETE", "/videos/42", 200, "deleted 42", ""},
+		{"Wildcard", "PUT", "/static/css/site.css", 200, "static css/site.css", ""},
+		{"Empty wildcard", "GET", "/static/", 200, "static ", ""},
+		{"Unknown path", "GET", "/nothing", 404, "Not Found\n", ""},
+		{"Too many segments", "GET", "/videos/42/extra", 404, "Not Found\n", ""},
+		{"Wrong method", "POST", "/videos/42", 405, "Method Not Allowed\n", "DELETE, GET, HEAD, OPTIONS"},
+		{"Automatic OPTIONS", "OPTIONS", "/upload", 204, "", "OPTIONS, POST"},
+		{"Automatic HEAD", "HEAD", "/videos/42", 200, "", ""},
+		{"Decoded parameter", "GET", "/videos/a%20b%2Fc", 200, "video a b/c", ""},
+		{"Encoded literal", "GET", "/videos/l%61test", 200, "latest", ""},
+		{"Absolute form", "GET", "http://example.com/videos/42?t=10", 200, "video 42", ""},
+		{"OPTIONS for the whole server", "OPTIONS", "*", 204, "", "DELETE, GET, HEAD, OPTIONS, POST"},
+		{"Invalid target", "GET", "/videos/<42>", 400, "error: invalid request target: invalid characters in \"/videos/<42>\"\n", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body, err := roundTrip(addr, tt.method, tt.target, "")
+			require.NoError(t, err)
+			assert.Equal(t, tt.statusCode, resp.StatusCode)
+			assert.Equal(t, tt.body, body)
+			assert.Equal(t, tt.allow, resp.Header.Get("Allow"))
+		})
+	}
+}
+
+func TestRouterHeadContentLength(t *testing.T) {
+	router := NewRouter()
+	router.Handle("GET /", func(w *response.Writer, req *request.Request) {
+		writeText(w, "hello")
+	})
+	_, addr := startServer(t, router.ServeHTTP)
+
+	// Test: HEAD keeps the headers of the GET response
+	resp, body, err := roundTrip(addr, "HEAD", "/", "")
+	require.NoError(t, err)
+	assert.Equal(t, "", body)
+	assert.Equal(t, int64(5), resp.ContentLength)
+}
+
+func TestRouterInvalidPatterns(t *testing.T) {
+	router := NewRouter()
+	assert.Panics(t, func() { router.Handle("GET videos", nil) })
+	assert.Panics(t, func() { router.Handle("/static/*path/more", nil) })
+	assert.Panics(t, func() { router.Handle("/{id}/{id}", nil) })
+
+	router.Handle("GET /videos", nil)
+	assert.Panics(t, func() { router.Handle("GET /videos", nil) })
+}
@@ -1,15 +1,23 @@
 package server
 
 import (
+	"errors"
+	"io"
 	"log"
+	"math"
 	"net"
+	"runtime/debug"
 	"strconv"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/sambakker4/httpfromtcp/internal/request"
 	"github.com/sambakker4/httpfromtcp/internal/response"
 )
 
+const maxDrainSize = 256 << 10
+
 type Handler func(w *response.Writer, req *request.Request)
 
 type HandlerError struct {
@@ -17,13 +25,126 @@ type HandlerError struct {
 	Message    string
 }
 
+// Write sends the error as a plain text response, in place of anything
+// the handler left pending.
+func (he HandlerError) Write(w *response.Writer) error {
+	err := w.Discard()
+	if err != nil {
+		return err
+	}
+
+	body := he.Message + "\n"
+	headers := response.GetDefaultHeaders(len(body))
+	if w.CloseConnection {
+		headers.Set("Connection", "close")
+	}
+
+	err = w.WriteStatusLine(he.StatusCode)
+	if err != nil {
+		return err
+	}
+
+	err = w.WriteHeaders(headers)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.WriteBody([]byte(body))
+	return err
+}
+
 type Server struct {
 	Listener    net.Listener
 	isClosed    *atomic.Bool
+	closed      chan struct{}
 	HandlerFunc Handler
+
+	// connSlots holds one value per connection being served. It is nil
+	// when the number of connections isn't limited.
+	connSlots      chan struct{}
+	overloadPolicy OverloadPolicy
+	retryAfter     time.Duration
+
+	// rejectSlots holds one value per connection being rejected, so a
+	// flood of connections can't pile up waiting for their 503.
+	rejectSlots chan struct{}
+
+	readHeaderTimeout time.Duration
+	readTimeout       time.Duration
+	writeTimeout      time.Duration
+	idleTimeout       time.Duration
+
+	limits        request.Limits
+	middlewares   []Middleware
+	recoverPanics bool
+
+	mu    sync.Mutex
+	conns map[net.Conn]connState
+}
+
+// OverloadPolicy decides what happens to a new connection when the server
+// is already serving its maximum number of connections.
+type OverloadPolicy int
+
+const (
+	// OverloadQueue waits for a connection to finish before serving the
+	// new one.
+	OverloadQueue OverloadPolicy = iota
+	// OverloadReject answers the new connection with 503 Service
+	// Unavailable and closes it.
+	OverloadReject
+)
+
+const (
+	defaultRetryAfter = time.Second
+	closeWaitTimeout  = 500 * time.Millisecond
+	// maxRejecting is how many connections can be getting a 503 at once.
+	// Connections over it are closed without one.
+	maxRejecting = 64
+)
+
+type Option func(*Server)
+
+// WithMaxConnections limits the number of connections served at the same
+// time. A limit of 0 means no limit.
+func WithMaxConnections(n int) Option {
+	return func(s *Server) {
+		if n > 0 {
+			s.connSlots = make(chan struct{}, n)
+		}
+	}
 }
 
-func Serve(port int, handler Handler) (*Server, error) {
+func WithOverloadPolicy(policy OverloadPolicy) Option {
+	return func(s *Server) {
+		s.overloadPolicy = policy
+	}
+}
+
+// WithRetryAfter sets the Retry-After sent with rejected connections.
+func WithRetryAfter(d time.Duration) Option {
+	return func(s *Server) {
+		s.retryAfter = d
+	}
+}
+
+// WithLimits sets the size limits for requests. Routes may raise or lower
+// the body limit by changing Request.MaxBodyBytes before reading the body.
+func WithLimits(limits request.Limits) Option {
+	return func(s *Server) {
+		s.limits = limits
+	}
+}
+
+// WithPanicRecovery decides whether a panicking handler is recovered from.
+// It is enabled by default; when disabled, a panic crashes the server.
+func WithPanicRecovery(enabled bool) Option {
+	return func(s *Server) {
+		s.recoverPanics = enabled
+	}
+}
+
+func Serve(port int, handler Handler, opts ...Option) (*Server, error) {
 	listener, err := net.Listen("tcp", ":"+strconv.Itoa(port))
 	if err != nil {
 		return &Server{}, err
@@ -35,8 +156,20 @@ func Serve(port int, handler Handler) (*Server, error) {
 	server := &Server{
 		Listener:    listener,
 		isClosed:    isClosed,
+		closed:      make(chan struct{}),
 		HandlerFunc: handler,
+		conns:       map[net.Conn]connState{},
+		retryAfter:  defaultRetryAfter,
+		rejectSlots: make(chan struct{}, maxRejecting),
+		limits:      request.DefaultLimits,
+
+		recoverPanics: true,
+	}
+
+	for _, opt := range opts {
+		opt(server)
 	}
+	server.HandlerFunc = Chain(server.middlewares...)(server.HandlerFunc)
 
 	go server.listen()
 
@@ -44,7 +177,14 @@ func Serve(port int, handler Handler) (*Server, error) {
 }
 
 func (s *Server) Close() error {
-	s.isClosed.Store(true)
+	// Taking the lock orders closing with trackConn.
+	s.mu.Lock()
+	wasClosed := s.isClosed.Swap(true)
+	s.mu.Unlock()
+	if wasClosed {
+		return nil
+	}
+	close(s.closed)
 	err := s.Listener.Close()
 	return err
 }
@@ -53,6 +193,9 @@ func (s *Server) listen() {
 	for !s.isClosed.Load() {
 		connection, err := s.Listener.Accept()
 		if s.isClosed.Load() {
+			if err == nil {
+				connection.Close()
+			}
 			break
 		}
 
@@ -60,21 +203,271 @@ func (s *Server) listen() {
 			log.Printf("connection error: %s\n", err.Error())
 			continue
 		}
-		s.handle(connection)
+
+		if !s.acquireSlot(connection) {
+			continue
+		}
+
+		if !s.trackConn(connection) {
+			s.releaseSlot()
+			connection.Close()
+			break
+		}
+		go func() {
+			defer s.releaseSlot()
+			defer s.untrackConn(connection)
+			s.handle(connection)
+		}()
 	}
 }
 
+// acquireSlot reserves a place for conn under the connection limit. It
+// reports false if conn was rejected or the server closed while waiting.
+func (s *Server) acquireSlot(conn net.Conn) bool {
+	if s.connSlots == nil {
+		return true
+	}
+
+	select {
+	case s.connSlots <- struct{}{}:
+		return true
+	default:
+	}
+
+	if s.overloadPolicy == OverloadReject {
+		select {
+		case s.rejectSlots <- struct{}{}:
+			go func() {
+				defer func() { <-s.rejectSlots }()
+				s.reject(conn)
+			}()
+		default:
+			conn.Close()
+		}
+		return false
+	}
+
+	select {
+	case s.connSlots <- struct{}{}:
+		return true
+	case <-s.closed:
+		conn.Close()
+		return false
+	}
+}
+
+func (s *Server) releaseSlot() {
+	if s.connSlots != nil {
+		<-s.connSlots
+	}
+}
+
+func (s *Server) reject(conn net.Conn) {
+	defer conn.Close()
+
+	body := "Service Unavailable\n"
+	headers := response.GetDefaultHeaders(len(body))
+	headers.Set("Retry-After", strconv.Itoa(int(math.Ceil(s.retryAfter.Seconds()))))
+	headers.Set("Connection", "close")
+
+	writer := response.Writer{
+		Writer:          conn,
+		CloseConnection: true,
+	}
+	writer.WriteStatusLine(response.ServiceUnavailable)
+	writer.WriteHeaders(headers)
+	writer.WriteBody([]byte(body))
+
+	closeWriteAndWait(conn)
+}
+
+// closeWriteAndWait gives the client a moment to read a response written
+// without reading its request. Closing a socket with unread data resets the
+// connection, which can discard the response before the client sees it.
+func closeWriteAndWait(conn net.Conn) {
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		tcpConn.CloseWrite()
+	}
+	conn.SetReadDeadline(time.Now().Add(closeWaitTimeout))
+	io.Copy(io.Discard, conn)
+}
+
 func (s *Server) handle(conn net.Conn) {
 	defer conn.Close()
-	req, err := request.RequestFromReader(conn)
+	sc := &serverConn{Conn: conn, server: s, waiting: true}
+	reader := request.NewReader(sc)
+	reader.Limits = s.limits
+	conn.SetReadDeadline(deadline(time.Now(), s.headerTimeout()))
+
+	for {
+		req, err := request.RequestFromReader(reader)
+		if errors.Is(err, io.EOF) {
+			return
+		}
+
+		// Running out of time before a request started is just an idle
+		// connection going away, but a partial request gets a 408.
+		if isTimeout(err) {
+			if !sc.waiting {
+				s.writeError(conn, HandlerError{StatusCode: response.RequestTimeout, Message: "Request Timeout"}, req.RequestLine.HttpVersion)
+			}
+			return
+		}
+
+		var parseErr *request.ParseError
+		if errors.As(err, &parseErr) {
+			s.writeError(conn, HandlerError{
+				StatusCode: response.StatusCode(parseErr.StatusCode),
+				Message:    err.Error(),
+			}, req.RequestLine.HttpVersion)
+			return
+		}
+
+		if err != nil {
+			if !s.isClosed.Load() {
+				log.Printf("request error: %s", err.Error())
+			}
+			return
+		}
+
+		// HTTP/1.1 requests must name the host they are for, and no request
+		// may name more than one.
+		hosts := req.Headers.Values("Host")
+		if len(hosts) > 1 || (len(hosts) == 0 && req.RequestLine.HttpVersion != "1.0") {
+			s.writeError(conn, HandlerError{StatusCode: response.BadRequest, Message: "error: missing or repeated Host header"}, req.RequestLine.HttpVersion)
+			return
+		}
+
+		if sc.waiting {
+			sc.startRequest()
+		}
+		conn.SetReadDeadline(deadline(sc.requestStart, s.readTimeout))
+		conn.SetWriteDeadline(deadline(time.Now(), s.writeTimeout))
+
+		writer := response.Writer{
+			Writer:          sc,
+			CloseConnection: !req.KeepAlive() || s.isClosed.Load(),
+			OmitBody:        req.RequestLine.Method == "HEAD",
+			HttpVersion:     req.RequestLine.HttpVersion,
+		}
+
+		body := &bodyReader{Reader: req.Body}
+		req.Body = body
+
+		if s.serveRequest(&writer, req, conn) {
+			return
+		}
+
+		// A handler that gave up because the body was invalid or too large
+		// gets the matching error response, in place of whatever it left
+		// buffered.
+		bodyErr := body.err
+		if decoded, ok := req.Body.(*bodyReader); ok && decoded.err != nil {
+			bodyErr = decoded.err
+		}
+		if !writer.Started() && errors.As(bodyErr, &parseErr) {
+			s.writeError(conn, HandlerError{
+				StatusCode: response.StatusCode(parseErr.StatusCode),
+				Message:    bodyErr.Error(),
+			}, req.RequestLine.HttpVersion)
+			return
+		}
+
+		err = writer.Finish()
+		if err != nil {
+			if !writer.Started() {
+				writeInternalError(&writer)
+			}
+			log.Printf("response error: %s", err.Error())
+			return
+		}
+
+		if writer.CloseConnection || sc.writeErr != nil || s.isClosed.Load() {
+			return
+		}
+
+		// Drain what is left of the body as sent, whatever the handler
+		// replaced req.Body with.
+		if !drainBody(body) {
+			return
+		}
+		sc.waitForRequest()
+	}
+}
+
+// writeError answers a request that couldn't be read and closes the
+// connection. httpVersion is the version of the request, or "" if its
+// request line couldn't be parsed.
+func (s *Server) writeError(conn net.Conn, he HandlerError, httpVersion string) {
+	conn.SetWriteDeadline(time.Now().Add(closeWaitTimeout))
+	writer := response.Writer{
+		Writer:          conn,
+		CloseConnection: true,
+		HttpVersion:     httpVersion,
+	}
+	he.Write(&writer)
+	closeWriteAndWait(conn)
+}
+
+// serveRequest runs the handler. If it panics, the panic is logged and the
+// client gets a 500 when nothing has been sent yet. serveRequest reports
+// whether the handler panicked, in which case the connection should be
+// closed.
+func (s *Server) serveRequest(w *response.Writer, req *request.Request, conn net.Conn) (panicked bool) {
+	if !s.recoverPanics {
+		s.HandlerFunc(w, req)
+		return false
+	}
+
+	defer func() {
+		rec := recover()
+		if rec == nil {
+			return
+		}
+		panicked = true
+
+		log.Printf("panic serving %s %s for %s: %v\n%s",
+			req.RequestLine.Method, req.RequestLine.RequestTarget, conn.RemoteAddr(), rec, debug.Stack())
+
+		if !w.Started() {
+			writeInternalError(w)
+		}
+	}()
+
+	s.HandlerFunc(w, req)
+	return false
+}
+
+// writeInternalError sends a 500 in place of the response the handler
+// failed to write, and finishes it so a compressed body is complete.
+func writeInternalError(w *response.Writer) {
+	w.CloseConnection = true
+	err := HandlerError{StatusCode: response.InternalServerError, Message: "Internal Server Error"}.Write(w)
 	if err != nil {
-		log.Printf("request error: %s", err.Error())
 		return
 	}
+	w.Finish()
+}
 
-	writer := response.Writer{
-		Writer: conn,
+// bodyReader remembers the first error reading the request body.
+type bodyReader struct {
+	io.Reader
+	err error
+}
+
+func (b *bodyReader) Read(p []byte) (int, error) {
+	n, err := b.Reader.Read(p)
+	if err != nil && !errors.Is(err, io.EOF) && b.err == nil {
+		b.err = err
 	}
+	return n, err
+}
 
-	s.HandlerFunc(&writer, req)
+// drainBody reads what the handler left of the request body so the next
+// request can be parsed. It reports false if the body is too large to be
+// worth reading or couldn't be read, in which case the connection should
+// be closed instead.
+func drainBody(body io.Reader) bool {
+	_, err := io.CopyN(io.Discard, body, maxDrainSize)
+	return errors.Is(err, io.EOF)
 }
@@ -0,0 +1,696 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sambakker4/httpfromtcp/internal/request"
+	"github.com/sambakker4/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func startServer(t *testing.T, handler Handler, opts ...Option) (*Server, string) {
+	t.Helper()
+	s, err := Serve(0, handler, opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+	return s, s.Listener.Addr().String()
+}
+
+func writeText(w *response.Writer, body string) {
+	w.WriteStatusLine(response.Success)
+	w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+	w.WriteBody([]byte(body))
+}
+
+func TestKeepAlive(t *testing.T) {
+	_, addr := startServer(t, func(w *response.Writer, req *request.Request) {
+		writeText(w, req.RequestLine.RequestTarget)
+	})
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	// Test: Two requests on one connection
+	for _, target := range []string{"/first", "/second"} {
+		_, err = conn.Write([]byte("GET " + target + " HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+		require.NoError(t, err)
+
+		resp, err := http.ReadResponse(reader, nil)
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, target, string(body))
+		assert.False(t, resp.Close)
+	}
+
+	// Test: Connection: close from the client
+	_, err = conn.Write([]byte("GET /last HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n"))
+	require.NoError(t, err)
+	resp, err := http.ReadResponse(reader, nil)
+	require.NoError(t, err)
+	assert.True(t, resp.Close)
+	io.ReadAll(resp.Body)
+
+	_, err = reader.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestHTTPVersions(t *testing.T) {
+	_, addr := startServer(t, func(w *response.Writer, req *request.Request) {
+		writeText(w, req.RequestLine.RequestTarget)
+	})
+
+	// Test: HTTP/1.0 without a Host, answered as HTTP/1.0 and closed
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	_, err = conn.Write([]byte("GET /old HTTP/1.0\r\n\r\n"))
+	require.NoError(t, err)
+	resp, err := http.ReadResponse(reader, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.0", resp.Proto)
+	assert.True(t, resp.Close)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "/old", string(body))
+	_, err = reader.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+
+	// Test: HTTP/1.0 keep-alive
+	conn, err = net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	reader = bufio.NewReader(conn)
+
+	for _, target := range []string{"/first", "/second"} {
+		_, err = conn.Write([]byte("GET " + target + " HTTP/1.0\r\nConnection: keep-alive\r\n\r\n"))
+		require.NoError(t, err)
+		resp, err := http.ReadResponse(reader, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "keep-alive", resp.Header.Get("Connection"))
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, target, string(body))
+	}
+
+	// Test: Rejected versions and Host headers, answered in the client's
+	// version when it is known
+	tests := []struct {
+		name       string
+		data       string
+		statusCode int
+		proto      string
+	}{
+		{"HTTP/1.1 without a Host", "GET / HTTP/1.1\r\n\r\n", http.StatusBadRequest, "HTTP/1.1"},
+		{"Two Hosts", "GET / HTTP/1.0\r\nHost: a\r\nHost: b\r\n\r\n", http.StatusBadRequest, "HTTP/1.0"},
+		{"HTTP/2.0", "GET / HTTP/2.0\r\nHost: localhost\r\n\r\n", http.StatusHTTPVersionNotSupported, "HTTP/1.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := net.Dial("tcp", addr)
+			require.NoError(t, err)
+			defer conn.Close()
+
+			_, err = conn.Write([]byte(tt.data))
+			require.NoError(t, err)
+			resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+			require.NoError(t, err)
+			assert.Equal(t, tt.statusCode, resp.StatusCode)
+			assert.Equal(t, tt.proto, resp.Proto)
+		})
+	}
+}
+
+func TestKeepAliveUnreadBody(t *testing.T) {
+	_, addr := startServer(t, func(w *response.Writer, req *request.Request) {
+		writeText(w, req.RequestLine.RequestTarget)
+	})
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	// Test: The server skips a body the handler didn't read
+	_, err = conn.Write([]byte("POST /upload HTTP/1.1\r\nHost: localhost\r\nContent-Length: 5\r\n\r\nhello" +
+		"GET /next HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+
+	for _, target := range []string{"/upload", "/next"} {
+		resp, err := http.ReadResponse(reader, nil)
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, target, string(body))
+	}
+}
+
+func TestAutomaticFraming(t *testing.T) {
+	large := strings.Repeat("x", 10000)
+	_, addr := startServer(t, func(w *response.Writer, req *request.Request) {
+		switch req.RequestLine.RequestTarget {
+		case "/small":
+			w.Write([]byte("small"))
+		case "/large":
+			w.Write([]byte(large))
+		case "/short":
+			w.Headers().Set("Content-Length", "10")
+			w.Write([]byte("short"))
+		case "/bad-header":
+			w.Headers().Set("X-Bad", "a\r\nb")
+			w.Write([]byte("never sent"))
+		}
+	})
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	// Test: Buffered and chunked bodies keep the connection open
+	for _, tt := range []struct{ target, body string }{{"/small", "small"}, {"/large", large}, {"/small", "small"}} {
+		_, err = conn.Write([]byte("GET " + tt.target + " HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+		require.NoError(t, err)
+
+		resp, err := http.ReadResponse(reader, nil)
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, tt.body, string(body))
+		assert.False(t, resp.Close)
+	}
+
+	// Test: A body shorter than its Content-Length closes the connection
+	_, _, err = roundTrip(addr, "GET", "/short", "")
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	// Test: Invalid headers become a 500
+	resp, _, err := roundTrip(addr, "GET", "/bad-header", "")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+}
+
+// roundTrip sends a request on a new connection and reads the response
+// and its body. headers holds extra header lines, each ending in CRLF.
+func roundTrip(addr string, method string, target string, headers string) (*http.Response, string, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, "", err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(method + " " + target + " HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n" + headers + "\r\n"))
+	if err != nil {
+		return nil, "", err
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), &http.Request{Method: method})
+	if err != nil {
+		return nil, "", err
+	}
+	body, err := io.ReadAll(resp.Body)
+	return resp, string(body), err
+}
+
+func TestConcurrentConnections(t *testing.T) {
+	// Both handlers have to be running at the same time to get past the
+	// barrier, so this only passes if the clients are served in parallel.
+	var arrived sync.WaitGroup
+	arrived.Add(2)
+	barrier := make(chan struct{})
+	go func() {
+		arrived.Wait()
+		close(barrier)
+	}()
+
+	_, addr := startServer(t, func(w *response.Writer, req *request.Request) {
+		arrived.Done()
+		select {
+		case <-barrier:
+			writeText(w, "ok")
+		case <-time.After(2 * time.Second):
+			writeText(w, "timed out")
+		}
+	})
+
+	results := make(chan string, 2)
+	for range 2 {
+		go func() {
+			resp, _, err := roundTrip(addr, "GET", "/slow", "")
+			if err != nil {
+				results <- err.Error()
+				return
+			}
+			results <- resp.Status
+		}()
+	}
+
+	for range 2 {
+		assert.Equal(t, "200 OK", <-results)
+	}
+
+	select {
+	case <-barrier:
+	default:
+		t.Fatal("handlers were not run concurrently")
+	}
+}
+
+func TestMaxConnectionsReject(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	_, addr := startServer(t, func(w *response.Writer, req *request.Request) {
+		close(started)
+		<-release
+		writeText(w, "ok")
+	}, WithMaxConnections(1), WithOverloadPolicy(OverloadReject), WithRetryAfter(5*time.Second))
+
+	first := make(chan *http.Response, 1)
+	go func() {
+		resp, _, _ := roundTrip(addr, "GET", "/slow", "")
+		first <- resp
+	}()
+	<-started
+
+	// Test: A second connection over the limit is rejected
+	resp, _, err := roundTrip(addr, "GET", "/second", "")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, "5", resp.Header.Get("Retry-After"))
+
+	close(release)
+	resp = <-first
+	require.NotNil(t, resp)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestMaxConnectionsRejectLimit(t *testing.T) {
+	s := &Server{
+		connSlots:      make(chan struct{}, 1),
+		overloadPolicy: OverloadReject,
+		rejectSlots:    make(chan struct{}, 1),
+	}
+	s.connSlots <- struct{}{}
+	s.rejectSlots <- struct{}{}
+
+	// Test: With too many connections being rejected, the next one is
+	// closed without a response
+	client, server := net.Pipe()
+	defer client.Close()
+	assert.False(t, s.acquireSlot(server))
+	_, err := client.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestMaxConnectionsQueue(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, 2)
+	_, addr := startServer(t, func(w *response.Writer, req *request.Request) {
+		started <- struct{}{}
+		if req.RequestLine.RequestTarget == "/slow" {
+			<-release
+		}
+		writeText(w, "ok")
+	}, WithMaxConnections(1))
+
+	first := make(chan *http.Response, 1)
+	go func() {
+		resp, _, _ := roundTrip(addr, "GET", "/slow", "")
+		first <- resp
+	}()
+	<-started
+
+	// Test: A second connection waits until the first is done
+	second := make(chan *http.Response, 1)
+	go func() {
+		resp, _, _ := roundTrip(addr, "GET", "/fast", "")
+		second <- resp
+	}()
+
+	select {
+	case <-started:
+		t.Fatal("second connection served before the first finished")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+	resp := <-first
+	require.NotNil(t, resp)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = <-second
+	require.NotNil(t, resp)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestShutdownDrainsActiveRequests(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	s, addr := startServer(t, func(w *response.Writer, req *request.Request) {
+		close(started)
+		<-release
+		writeText(w, "done")
+	})
+
+	// An idle keep-alive connection that should be closed right away
+	idle, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer idle.Close()
+
+	result := make(chan *http.Response, 1)
+	go func() {
+		resp, _, _ := roundTrip(addr, "GET", "/slow", "")
+		result <- resp
+	}()
+	<-started
+
+	shutdown := make(chan error, 1)
+	go func() {
+		cutOff, err := s.Shutdown(context.Background())
+		assert.Equal(t, 0, cutOff)
+		shutdown <- err
+	}()
+
+	// Test: The idle connection is closed while the request is in progress
+	idle.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = idle.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, io.EOF)
+
+	// Test: New connections are refused
+	_, _, err = roundTrip(addr, "GET", "/new", "")
+	assert.Error(t, err)
+
+	select {
+	case <-shutdown:
+		t.Fatal("Shutdown returned before the active request finished")
+	default:
+	}
+
+	close(release)
+	resp := <-result
+	require.NotNil(t, resp)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NoError(t, <-shutdown)
+}
+
+func TestTrackConnAfterClose(t *testing.T) {
+	s, _ := startServer(t, func(w *response.Writer, req *request.Request) {})
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	// Test: A connection accepted just before Close is either tracked, so
+	// Shutdown waits for it, or refused
+	require.NoError(t, s.Close())
+	assert.False(t, s.trackConn(server))
+	assert.True(t, s.closeIdleConns())
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	s, addr := startServer(t, func(w *response.Writer, req *request.Request) {
+		close(started)
+		<-release
+	})
+
+	go roundTrip(addr, "GET", "/stuck", "")
+	<-started
+
+	// Test: Connections still active when the context expires are cut off
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	cutOff, err := s.Shutdown(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, 1, cutOff)
+}
+
+func TestReadHeaderTimeout(t *testing.T) {
+	_, addr := startServer(t, func(w *response.Writer, req *request.Request) {
+		writeText(w, "ok")
+	}, WithReadHeaderTimeout(100*time.Millisecond), WithIdleTimeout(100*time.Millisecond))
+
+	// Test: A request that never finishes its headers gets a 408
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("GET / HTTP/1.1\r\nHost: loc"))
+	require.NoError(t, err)
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusRequestTimeout, resp.StatusCode)
+	assert.True(t, resp.Close)
+
+	// Test: An idle connection is closed without a response
+	idle, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer idle.Close()
+	idle.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, err := idle.Read(make([]byte, 1))
+	assert.Equal(t, 0, n)
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestReadTimeout(t *testing.T) {
+	errs := make(chan error, 1)
+	_, addr := startServer(t, func(w *response.Writer, req *request.Request) {
+		_, err := io.ReadAll(req.Body)
+		errs <- err
+	}, WithReadTimeout(100*time.Millisecond))
+
+	// Test: A body that stalls past the deadline fails to read
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 10\r\n\r\nhello"))
+	require.NoError(t, err)
+
+	select {
+	case err := <-errs:
+		var netErr net.Error
+		require.ErrorAs(t, err, &netErr)
+		assert.True(t, netErr.Timeout())
+	case <-time.After(2 * time.Second):
+		t.Fatal("the body read didn't time out")
+	}
+
+	// Test: The connection is closed afterwards
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, err = io.ReadAll(conn)
+	assert.NoError(t, err)
+}
+
+func TestWriteTimeout(t *testing.T) {
+	errs := make(chan error, 1)
+	_, addr := startServer(t, func(w *response.Writer, req *request.Request) {
+		chunk := make([]byte, 64<<10)
+		for range 1024 {
+			_, err := w.Write(chunk)
+			if err != nil {
+				errs <- err
+				return
+			}
+		}
+		errs <- nil
+	}, WithWriteTimeout(100*time.Millisecond))
+
+	// Test: A client that stops reading a large response makes the
+	// handler's writes time out
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+
+	select {
+	case err := <-errs:
+		var netErr net.Error
+		require.ErrorAs(t, err, &netErr)
+		assert.True(t, netErr.Timeout())
+	case <-time.After(5 * time.Second):
+		t.Fatal("the response write didn't time out")
+	}
+}
+
+func TestIdleTimeoutAfterRequest(t *testing.T) {
+	_, addr := startServer(t, func(w *response.Writer, req *request.Request) {
+		writeText(w, "ok")
+	}, WithIdleTimeout(100*time.Millisecond))
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	_, err = conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	resp, err := http.ReadResponse(reader, nil)
+	require.NoError(t, err)
+	io.ReadAll(resp.Body)
+
+	// Test: The keep-alive connection is closed once it has been idle
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, err = reader.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestMalformedRequests(t *testing.T) {
+	_, addr := startServer(t, func(w *response.Writer, req *request.Request) {
+		writeText(w, "ok")
+	})
+
+	tests := []struct {
+		name       string
+		data       string
+		statusCode int
+	}{
+		{"Malformed request line", "GET /\r\n\r\n", http.StatusBadRequest},
+		{"Unsupported version", "GET / HTTP/2.0\r\nHost: localhost\r\n\r\n", http.StatusHTTPVersionNotSupported},
+		{"Bad header", "GET / HTTP/1.1\r\nHost localhost\r\n\r\n", http.StatusBadRequest},
+		{"Unsupported transfer encoding", "POST / HTTP/1.1\r\nTransfer-Encoding: gzip\r\n\r\n", http.StatusNotImplemented},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := net.Dial("tcp", addr)
+			require.NoError(t, err)
+			defer conn.Close()
+
+			_, err = conn.Write([]byte(tt.data))
+			require.NoError(t, err)
+
+			resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+			require.NoError(t, err)
+			assert.Equal(t, tt.statusCode, resp.StatusCode)
+			assert.True(t, resp.Close)
+		})
+	}
+}
+
+func TestRequestLimits(t *testing.T) {
+	_, addr := startServer(t, func(w *response.Writer, req *request.Request) {
+		switch req.RequestLine.RequestTarget {
+		case "/big":
+			req.MaxBodyBytes = 100
+		case "/buffered":
+			w.Write([]byte("received: "))
+		case "/created":
+			w.SetStatus(response.Created)
+		}
+
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			return
+		}
+		writeText(w, string(body))
+	}, WithLimits(request.Limits{MaxHeaderCount: 2, MaxBodyBytes: 5}))
+
+	tests := []struct {
+		name       string
+		data       string
+		statusCode int
+		proto      string
+	}{
+		{"Too many headers", "GET / HTTP/1.1\r\nA: 1\r\nB: 2\r\nC: 3\r\n\r\n", http.StatusRequestHeaderFieldsTooLarge, "HTTP/1.1"},
+		{"Too many headers for HTTP/1.0", "GET / HTTP/1.0\r\nA: 1\r\nB: 2\r\nC: 3\r\n\r\n", http.StatusRequestHeaderFieldsTooLarge, "HTTP/1.0"},
+		{"Body too large", "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 11\r\n\r\nhello world", http.StatusRequestEntityTooLarge, "HTTP/1.1"},
+		{"Body too large for HTTP/1.0", "POST / HTTP/1.0\r\nContent-Length: 11\r\n\r\nhello world", http.StatusRequestEntityTooLarge, "HTTP/1.0"},
+		{"Body too large after a buffered write", "POST /buffered HTTP/1.1\r\nHost: localhost\r\nContent-Length: 11\r\n\r\nhello world", http.StatusRequestEntityTooLarge, "HTTP/1.1"},
+		{"Body too large after setting the status", "POST /created HTTP/1.1\r\nHost: localhost\r\nContent-Length: 11\r\n\r\nhello world", http.StatusRequestEntityTooLarge, "HTTP/1.1"},
+		{"Body limit raised by the handler", "POST /big HTTP/1.1\r\nHost: localhost\r\nContent-Length: 11\r\n\r\nhello world", http.StatusOK, "HTTP/1.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := net.Dial("tcp", addr)
+			require.NoError(t, err)
+			defer conn.Close()
+
+			_, err = conn.Write([]byte(tt.data))
+			require.NoError(t, err)
+
+			resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+			require.NoError(t, err)
+			assert.Equal(t, tt.statusCode, resp.StatusCode)
+			assert.Equal(t, tt.proto, resp.Proto)
+		})
+	}
+}
+
+func TestPanicRecovery(t *testing.T) {
+	router := NewRouter()
+	router.Handle("GET /early", func(w *response.Writer, req *request.Request) {
+		panic("before writing")
+	})
+	router.Handle("GET /late", func(w *response.Writer, req *request.Request) {
+		w.WriteStatusLine(response.Success)
+		w.WriteHeaders(response.GetDefaultHeaders(100))
+		w.WriteBody([]byte("partial"))
+		panic("after writing")
+	})
+	router.Handle("GET /trailer", func(w *response.Writer, req *request.Request) {
+		w.DeclareTrailer("X-Checksum")
+		w.Headers().Set("X-Pending", "1")
+		panic("after declaring a trailer")
+	})
+	router.Handle("GET /ok", func(w *response.Writer, req *request.Request) {
+		writeText(w, "still up")
+	})
+	_, addr := startServer(t, router.ServeHTTP)
+
+	// Test: A panic before anything is written becomes a 500
+	resp, _, err := roundTrip(addr, "GET", "/early", "")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	assert.True(t, resp.Close)
+
+	// Test: Declared trailers and pending headers are dropped for the 500
+	resp, body, err := roundTrip(addr, "GET", "/trailer", "")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	assert.Equal(t, "Internal Server Error\n", body)
+	assert.Empty(t, resp.Header.Get("Trailer"))
+	assert.Empty(t, resp.Header.Get("X-Pending"))
+
+	// Test: A panic in the middle of the body aborts the connection
+	_, _, err = roundTrip(addr, "GET", "/late", "")
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	// Test: The server keeps serving
+	resp, _, err = roundTrip(addr, "GET", "/ok", "")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestPanicRecoveryDisabled(t *testing.T) {
+	s := &Server{
+		HandlerFunc: func(w *response.Writer, req *request.Request) {
+			panic("boom")
+		},
+	}
+	WithPanicRecovery(false)(s)
+
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	assert.PanicsWithValue(t, "boom", func() {
+		s.serveRequest(&response.Writer{Writer: server}, &request.Request{}, server)
+	})
+}
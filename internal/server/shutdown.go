@@ -0,0 +1,99 @@
+package server
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+type connState int
+
+const (
+	// connStateIdle is a connection waiting for its next request.
+	connStateIdle connState = iota
+	// connStateActive is a connection with a request in progress.
+	connStateActive
+)
+
+const shutdownPollInterval = 50 * time.Millisecond
+
+// trackConn records a new connection. It reports false if the server has
+// closed, in which case conn must not be served. Close marks the server
+// closed under the same lock, so Shutdown sees every connection tracked
+// here.
+func (s *Server) trackConn(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.isClosed.Load() {
+		return false
+	}
+	s.conns[conn] = connStateIdle
+	return true
+}
+
+func (s *Server) untrackConn(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.conns, conn)
+}
+
+func (s *Server) setConnState(conn net.Conn, state connState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.conns[conn]; ok {
+		s.conns[conn] = state
+	}
+}
+
+// closeIdleConns closes every idle connection and reports whether there
+// are no connections left.
+func (s *Server) closeIdleConns() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn, state := range s.conns {
+		if state == connStateIdle {
+			conn.Close()
+			delete(s.conns, conn)
+		}
+	}
+	return len(s.conns) == 0
+}
+
+// closeAllConns closes every remaining connection and returns how many
+// there were.
+func (s *Server) closeAllConns() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := len(s.conns)
+	for conn := range s.conns {
+		conn.Close()
+		delete(s.conns, conn)
+	}
+	return n
+}
+
+// Shutdown stops accepting connections, closes idle connections and waits
+// for the requests in progress to finish. When ctx expires first, the
+// remaining connections are closed; Shutdown returns how many were cut off
+// along with the context's error.
+func (s *Server) Shutdown(ctx context.Context) (int, error) {
+	err := s.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if s.closeIdleConns() {
+			return 0, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return s.closeAllConns(), ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"time"
+)
+
+// WithReadHeaderTimeout limits the time to read the request line and
+// headers, measured from the first byte of the request. It defaults to the
+// read timeout.
+func WithReadHeaderTimeout(d time.Duration) Option {
+	return func(s *Server) {
+		s.readHeaderTimeout = d
+	}
+}
+
+// WithReadTimeout limits the time to read a whole request, including its
+// body.
+func WithReadTimeout(d time.Duration) Option {
+	return func(s *Server) {
+		s.readTimeout = d
+	}
+}
+
+// WithWriteTimeout limits the time the handler has to write its response.
+func WithWriteTimeout(d time.Duration) Option {
+	return func(s *Server) {
+		s.writeTimeout = d
+	}
+}
+
+// WithIdleTimeout limits how long a keep-alive connection waits for its
+// next request. It defaults to the read timeout.
+func WithIdleTimeout(d time.Duration) Option {
+	return func(s *Server) {
+		s.idleTimeout = d
+	}
+}
+
+func (s *Server) headerTimeout() time.Duration {
+	if s.readHeaderTimeout > 0 {
+		return s.readHeaderTimeout
+	}
+	return s.readTimeout
+}
+
+func (s *Server) keepAliveTimeout() time.Duration {
+	if s.idleTimeout > 0 {
+		return s.idleTimeout
+	}
+	return s.readTimeout
+}
+
+// deadline returns the deadline for a timeout starting at start, or the
+// zero time for no deadline when timeout is 0.
+func deadline(start time.Time, timeout time.Duration) time.Time {
+	if timeout <= 0 {
+		return time.Time{}
+	}
+	return start.Add(timeout)
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}